@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/log"
+
+	"gomicro/config"
+	"gomicro/generate"
+)
+
+var errUsage = errors.New("usage", errors.WithoutStackTrace())
+
+// usage lists the commands, which is printed by -help and when the command is not known.
+const usage = `Usage:
+  gomicro [flags] [generate]                              generate the services
+  gomicro [flags] init <module> <service>                 create the config and the module of a physical service
+  gomicro [flags] add logical <name>                      add a logical service with an API and generate it
+  gomicro [flags] add dep <logical> <name> <path> <type>  add a dependency to a logical and generate its dependencies
+  gomicro [flags] remove logical <name>                   remove a logical and prune its generated files
+  gomicro [flags] lint                                    check the APIs against the API rules, exits non-zero on errors
+  gomicro [flags] check                                   regenerate in memory and list the stale generated files, exits non-zero if any
+  gomicro templates export [dir]                          write the built-in templates to dir as a starting point for overrides
+
+Flags may be given before or after the command. The commands that edit the config save it once the services were
+generated from it, so a failed generation or a dry run leaves the config untouched.
+
+Flags:
+`
+
+func printUsage() {
+	fmt.Fprint(flag.CommandLine.Output(), usage)
+	flag.PrintDefaults()
+}
+
+// command runs the command that args name, generate when there is none. It returns false when the command ran
+// but found problems, such as lint errors or generated files that were edited by hand.
+func command(ctx context.Context, args []string) (bool, error) {
+	if len(args) == 0 {
+		return generateServices(ctx)
+	}
+
+	switch args[0] {
+	case "generate":
+		_, err := commandArgs(args, 1, 0)
+		if err != nil {
+			return false, err
+		}
+
+		return generateServices(ctx)
+
+	case "init":
+		a, err := commandArgs(args, 1, 2)
+		if err != nil {
+			return false, err
+		}
+
+		return initService(ctx, a[0], a[1])
+
+	case "add":
+		if len(args) < 2 {
+			return false, errUsage
+		}
+
+		switch args[1] {
+		case "logical":
+			a, err := commandArgs(args, 2, 1)
+			if err != nil {
+				return false, err
+			}
+
+			return addLogical(ctx, a[0])
+
+		case "dep":
+			a, err := commandArgs(args, 2, 4)
+			if err != nil {
+				return false, err
+			}
+
+			return addDependency(ctx, a[0], config.Dep{Name: a[1], Path: a[2], Type: a[3]})
+		}
+
+	case "remove":
+		if len(args) < 2 || args[1] != "logical" {
+			return false, errUsage
+		}
+
+		a, err := commandArgs(args, 2, 1)
+		if err != nil {
+			return false, err
+		}
+
+		return removeLogical(ctx, a[0])
+
+	case "lint":
+		_, err := commandArgs(args, 1, 0)
+		if err != nil {
+			return false, err
+		}
+
+		c, err := config.ParseConfig(*configPath)
+		if err != nil {
+			return false, err
+		}
+
+		return lintAPIs(c, *outputPath)
+
+	case "check":
+		_, err := commandArgs(args, 1, 0)
+		if err != nil {
+			return false, err
+		}
+
+		c, err := config.ParseConfig(*configPath)
+		if err != nil {
+			return false, err
+		}
+
+		return checkGenerated(ctx, c, options(c))
+
+	case "templates":
+		if len(args) < 2 || args[1] != "export" || len(args) > 3 {
+			return false, errUsage
+		}
+
+		dir := "templates"
+		if len(args) == 3 {
+			dir = args[2]
+		}
+
+		return true, exportTemplates(dir)
+	}
+
+	return false, errUsage
+}
+
+// commandArgs returns the n arguments that follow the words naming the command and parses the flags after them.
+func commandArgs(args []string, words, n int) ([]string, error) {
+	args = args[words:]
+	if len(args) < n {
+		return nil, errUsage
+	}
+
+	err := flag.CommandLine.Parse(args[n:])
+	if err != nil {
+		return nil, errUsage
+	}
+
+	if flag.NArg() > 0 {
+		return nil, errUsage
+	}
+
+	return args[:n], nil
+}
+
+// options returns the generation options set by the flags.
+func options(c *config.Config) generate.Options {
+	o := generate.Options{
+		Root:        *outputPath,
+		DryRun:      *dryRun,
+		Force:       *force,
+		Full:        *full,
+		Prune:       *prune,
+		DeleteOwned: *deleteOwned,
+		Verify:      *verify,
+		Parallelism: *parallel,
+		Templates:   templatesDir(c),
+		Log:         log.Info,
+	}
+
+	if *stages != "" {
+		for _, s := range strings.Split(*stages, ",") {
+			o.Stages = append(o.Stages, generate.Stage(strings.TrimSpace(s)))
+		}
+	}
+
+	return o
+}
+
+// generateServices generates the services of the config.
+func generateServices(ctx context.Context) (bool, error) {
+	c, err := config.ParseConfig(*configPath)
+	if err != nil {
+		return false, err
+	}
+
+	o := options(c)
+	r, err := generate.Generate(ctx, c, o)
+	return report(o, r, err)
+}
+
+// initService creates the config of the physical service and generates its framework, which creates the module.
+func initService(ctx context.Context, module, service string) (bool, error) {
+	d, err := config.NewDocument(*configPath, module, service)
+	if err != nil {
+		return false, err
+	}
+
+	return edit(ctx, d, []generate.Stage{generate.StageFramework})
+}
+
+// addLogical adds a logical with an API served locally and over http, and generates it.
+func addLogical(ctx context.Context, name string) (bool, error) {
+	d, err := config.OpenDocument(*configPath)
+	if err != nil {
+		return false, err
+	}
+
+	err = d.AddLogical(config.Logical{
+		Name: name,
+		API: config.API{
+			FileName:      "api.go",
+			InterfaceName: "API",
+			Implementations: config.APIImplementation{
+				Local: true,
+				HTTP:  true,
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return edit(ctx, d, generate.Stages)
+}
+
+// addDependency adds the dependency to the logical and generates its dependencies.
+func addDependency(ctx context.Context, logical string, dep config.Dep) (bool, error) {
+	d, err := config.OpenDocument(*configPath)
+	if err != nil {
+		return false, err
+	}
+
+	err = d.AddDependency(logical, dep)
+	if err != nil {
+		return false, err
+	}
+
+	return edit(ctx, d, []generate.Stage{generate.StageDependencies})
+}
+
+// removeLogical removes the logical and prunes its generated files. Files of the logical written by hand, such as
+// its API, no longer build without the generated code so they are listed and the logical is kept unless deleting
+// them is asked for.
+func removeLogical(ctx context.Context, name string) (bool, error) {
+	d, err := config.OpenDocument(*configPath)
+	if err != nil {
+		return false, err
+	}
+
+	err = d.RemoveLogical(name)
+	if err != nil {
+		return false, err
+	}
+
+	return edit(ctx, d, generate.Stages, name)
+}
+
+// edit generates the stages from the edited config and saves it once the output tree was written, so that a failed
+// generation or a dry run leaves both the config and the output tree as they were. The directories of the removed
+// logicals are removed with it.
+func edit(ctx context.Context, d *config.Document, stages []generate.Stage, removed ...string) (bool, error) {
+	c, err := d.Config()
+	if err != nil {
+		return false, err
+	}
+
+	o := options(c)
+	o.Stages = stages
+	o.Removed = removed
+
+	r, err := generate.Generate(ctx, c, o)
+	if !o.DryRun && (err == nil || errors.Is(err, generate.ErrVerify)) {
+		serr := d.Save()
+		if serr != nil {
+			return false, serr
+		}
+	}
+
+	return report(o, r, err)
+}
+
+// report prints the diff of a dry run and the problems generation found. It returns false if there are any.
+func report(o generate.Options, r generate.Report, err error) (bool, error) {
+	if err != nil && !errors.Is(err, generate.ErrHandEdited) && !errors.Is(err, generate.ErrVerify) &&
+		!errors.Is(err, generate.ErrOwnedFiles) {
+		return false, err
+	}
+
+	if o.DryRun {
+		werr := r.Write(os.Stdout)
+		if werr != nil {
+			return false, werr
+		}
+	}
+
+	if errors.Is(err, generate.ErrHandEdited) {
+		printHandEdited(r)
+		return false, nil
+	}
+
+	if errors.Is(err, generate.ErrOwnedFiles) {
+		printOwned(r)
+		return false, nil
+	}
+
+	if errors.Is(err, generate.ErrVerify) {
+		for _, p := range r.Problems {
+			fmt.Println(p.String(r.Root))
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
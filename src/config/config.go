@@ -3,6 +3,9 @@ package config
 type Config struct {
 	Module  string  `yaml:"module"`
 	Service Service `yaml:"service"`
+	// Templates is a directory of template overrides named after the templates they replace, relative to the
+	// config file
+	Templates string `yaml:"templates,omitempty"`
 }
 
 type Service struct {
@@ -13,7 +16,10 @@ type Service struct {
 type Logical struct {
 	Name         string `yaml:"name"`
 	API          API    `yaml:"api"`
-	Dependencies []Dep  `yaml:"dependencies"`
+	Dependencies []Dep  `yaml:"dependencies,omitempty"`
+	// Generators are the names of registered generators that run for the logical after the built-in ones, such
+	// as in-house generators
+	Generators []string `yaml:"generators,omitempty"`
 }
 
 type Dep struct {
@@ -23,8 +29,11 @@ type Dep struct {
 }
 
 type API struct {
-	FileName        string            `yaml:"fileName"`
-	InterfaceName   string            `yaml:"interface"`
+	FileName      string `yaml:"fileName"`
+	InterfaceName string `yaml:"interface"`
+	// Interfaces are additional interfaces in the API file that transports are generated for
+	// alongside InterfaceName. Their generated types are prefixed with the interface name.
+	Interfaces      []string          `yaml:"interfaces,omitempty"`
 	Implementations APIImplementation `yaml:"implementations"`
 }
 
@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bytes"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"gopkg.in/yaml.v3"
+
+	"gomicro/ioeasy"
+)
+
+var (
+	// ErrConfigExists is returned when creating a config file that already exists.
+	ErrConfigExists = errors.New("config already exists", errors.WithoutStackTrace())
+	// ErrInvalidConfig is returned when the config file is not laid out like a Config.
+	ErrInvalidConfig = errors.New("invalid config", errors.WithoutStackTrace())
+	// ErrInvalidName is returned when the name of a logical or dependency is not a Go identifier.
+	ErrInvalidName = errors.New("invalid name", errors.WithoutStackTrace())
+	// ErrLogicalExists is returned when adding a logical with the name of another.
+	ErrLogicalExists = errors.New("logical already exists", errors.WithoutStackTrace())
+	// ErrLogicalNotFound is returned when editing a logical that is not in the config.
+	ErrLogicalNotFound = errors.New("logical not found", errors.WithoutStackTrace())
+	// ErrLogicalInUse is returned when removing a logical that other logicals depend on.
+	ErrLogicalInUse = errors.New("logical is a dependency of other logicals", errors.WithoutStackTrace())
+	// ErrDependencyExists is returned when adding a dependency with the name of another of the logical.
+	ErrDependencyExists = errors.New("dependency already exists", errors.WithoutStackTrace())
+)
+
+// Document is a config file that is edited as YAML rather than as a Config so that the comments and layout of the
+// file are kept when it is saved.
+type Document struct {
+	path string
+	node yaml.Node
+}
+
+// NewDocument returns the document of a config for the module and physical service that is saved to path, which
+// must not exist yet.
+func NewDocument(path, module, service string) (*Document, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return nil, errors.Wrap(ErrConfigExists, "", j.KV("path", path))
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	var value yaml.Node
+	err = value.Encode(&Config{Module: module, Service: Service{Name: service}})
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	quoteStrings(&value)
+
+	// The empty list of logicals is laid out as a block so that added logicals are too
+	_, s := mappingValue(&value, "service")
+	_, logicals := mappingValue(s, "logicals")
+	if logicals != nil {
+		logicals.Style = 0
+	}
+
+	return &Document{
+		path: path,
+		node: yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&value}},
+	}, nil
+}
+
+// OpenDocument reads the config file at path for editing.
+func OpenDocument(path string) (*Document, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	d := &Document{path: path}
+	err = yaml.Unmarshal(b, &d.node)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	if d.root() == nil {
+		return nil, errors.Wrap(ErrInvalidConfig, "not a mapping", j.KV("path", path))
+	}
+
+	return d, nil
+}
+
+// Config returns the config the document holds.
+func (d *Document) Config() (*Config, error) {
+	var c Config
+	err := d.node.Decode(&c)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("path", d.path))
+	}
+
+	return &c, nil
+}
+
+// AddLogical appends the logical to the logicals of the service.
+func (d *Document) AddLogical(logical Logical) error {
+	if !token.IsIdentifier(logical.Name) {
+		return errors.Wrap(ErrInvalidName, "", j.KV("logical", logical.Name))
+	}
+
+	_, _, err := d.logical(logical.Name)
+	if err == nil {
+		return errors.Wrap(ErrLogicalExists, "", j.KV("logical", logical.Name))
+	}
+
+	service, err := d.mapping(d.root(), "service")
+	if err != nil {
+		return err
+	}
+
+	logicals, err := d.sequence(service, "logicals")
+	if err != nil {
+		return err
+	}
+
+	var value yaml.Node
+	err = value.Encode(&logical)
+	if err != nil {
+		return errors.Wrap(err, "", j.KV("logical", logical.Name))
+	}
+	quoteStrings(&value)
+
+	logicals.Content = append(logicals.Content, &value)
+	return nil
+}
+
+// RemoveLogical removes the logical from the service along with the comments that belong to it. A logical that
+// other logicals depend on is kept.
+func (d *Document) RemoveLogical(name string) error {
+	logicals, i, err := d.logical(name)
+	if err != nil {
+		return err
+	}
+
+	c, err := d.Config()
+	if err != nil {
+		return err
+	}
+
+	path := strings.Join([]string{c.Module, c.Service.Name, name}, "/")
+
+	var dependants []string
+	for _, logical := range c.Service.Logicals {
+		for _, dep := range logical.Dependencies {
+			if dep.Path == path {
+				dependants = append(dependants, logical.Name)
+			}
+		}
+	}
+
+	if len(dependants) > 0 {
+		return errors.Wrap(ErrLogicalInUse, "", j.MKV{"logical": name, "dependants": strings.Join(dependants, ", ")})
+	}
+
+	logicals.Content = append(logicals.Content[:i], logicals.Content[i+1:]...)
+	return nil
+}
+
+// AddDependency appends the dependency to the dependencies of the logical.
+func (d *Document) AddDependency(logical string, dep Dep) error {
+	if !token.IsIdentifier(dep.Name) {
+		return errors.Wrap(ErrInvalidName, "", j.MKV{"logical": logical, "dependency": dep.Name})
+	}
+
+	logicals, i, err := d.logical(logical)
+	if err != nil {
+		return err
+	}
+
+	deps, err := d.sequence(logicals.Content[i], "dependencies")
+	if err != nil {
+		return err
+	}
+
+	for _, n := range deps.Content {
+		_, name := mappingValue(n, "name")
+		if name != nil && name.Value == dep.Name {
+			return errors.Wrap(ErrDependencyExists, "", j.MKV{"logical": logical, "dependency": dep.Name})
+		}
+	}
+
+	var value yaml.Node
+	err = value.Encode(&dep)
+	if err != nil {
+		return errors.Wrap(err, "", j.MKV{"logical": logical, "dependency": dep.Name})
+	}
+	quoteStrings(&value)
+
+	deps.Content = append(deps.Content, &value)
+	return nil
+}
+
+// Save writes the document to its file. The file is replaced in one go so that it is never left half written, and
+// keeps its mode.
+func (d *Document) Save() error {
+	var buf bytes.Buffer
+	e := yaml.NewEncoder(&buf)
+	e.SetIndent(2)
+
+	err := e.Encode(&d.node)
+	if err != nil {
+		return errors.Wrap(err, "", j.KV("path", d.path))
+	}
+
+	err = e.Close()
+	if err != nil {
+		return errors.Wrap(err, "", j.KV("path", d.path))
+	}
+
+	return ioeasy.WriteAtomic(d.path, buf.Bytes())
+}
+
+// root returns the top level mapping of the document, nil if there is none.
+func (d *Document) root() *yaml.Node {
+	if d.node.Kind != yaml.DocumentNode || len(d.node.Content) == 0 || d.node.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	return d.node.Content[0]
+}
+
+// logical returns the sequence of logicals of the service and the index of the named logical in it.
+func (d *Document) logical(name string) (*yaml.Node, int, error) {
+	_, service := mappingValue(d.root(), "service")
+	_, logicals := mappingValue(service, "logicals")
+	if logicals == nil || logicals.Kind != yaml.SequenceNode {
+		return nil, 0, errors.Wrap(ErrLogicalNotFound, "", j.KV("logical", name))
+	}
+
+	for i, n := range logicals.Content {
+		_, value := mappingValue(n, "name")
+		if value != nil && value.Value == name {
+			return logicals, i, nil
+		}
+	}
+
+	return nil, 0, errors.Wrap(ErrLogicalNotFound, "", j.KV("logical", name))
+}
+
+// mapping returns the mapping under key in the mapping n, adding an empty one if there is none.
+func (d *Document) mapping(n *yaml.Node, key string) (*yaml.Node, error) {
+	return d.child(n, key, yaml.MappingNode, "!!map")
+}
+
+// sequence returns the sequence under key in the mapping n, adding an empty one if there is none. An empty
+// sequence is laid out as a block so that the values appended to it are too.
+func (d *Document) sequence(n *yaml.Node, key string) (*yaml.Node, error) {
+	s, err := d.child(n, key, yaml.SequenceNode, "!!seq")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Content) == 0 {
+		s.Style = 0
+	}
+
+	return s, nil
+}
+
+func (d *Document) child(n *yaml.Node, key string, kind yaml.Kind, tag string) (*yaml.Node, error) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, errors.Wrap(ErrInvalidConfig, "not a mapping", j.MKV{"path": d.path, "key": key})
+	}
+
+	k, value := mappingValue(n, key)
+	if value == nil {
+		value = &yaml.Node{Kind: kind, Tag: tag}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+		return value, nil
+	}
+
+	// An empty value, such as "dependencies:", is replaced keeping the comments of the key
+	if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+		*value = yaml.Node{Kind: kind, Tag: tag, LineComment: value.LineComment}
+		return value, nil
+	}
+
+	if value.Kind != kind {
+		return nil, errors.Wrap(ErrInvalidConfig, "unexpected value", j.MKV{"path": d.path, "key": k.Value})
+	}
+
+	return value, nil
+}
+
+// mappingValue returns the key and value nodes of key in the mapping n, nil if there are none.
+func mappingValue(n *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+
+	return nil, nil
+}
+
+// quoteStrings double quotes the string values below n like the rest of the config.
+func quoteStrings(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			quoteStrings(n.Content[i])
+		}
+	case yaml.SequenceNode:
+		for _, c := range n.Content {
+			quoteStrings(c)
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!str" {
+			n.Style = yaml.DoubleQuotedStyle
+		}
+	}
+}
@@ -0,0 +1,423 @@
+// Package generate generates the services described by a gomicro config so that it can be embedded in build
+// tooling and go generate wrappers. The gomicro command is a thin wrapper around it.
+package generate
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/luno/jettison"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"gomicro/config"
+	"gomicro/ioeasy"
+	"gomicro/templates"
+	"gomicro/wireup"
+)
+
+// ErrHandEdited is returned when generated files were edited by hand since they were generated and Force is
+// not set. Nothing is written in that case and the report lists the files.
+var ErrHandEdited = errors.New("generated files were edited by hand", errors.WithoutStackTrace())
+
+// ErrUnknownStage is returned when the options name a stage that does not exist.
+var ErrUnknownStage = errors.New("unknown stage", errors.WithoutStackTrace())
+
+// Stage is a step of generation.
+type Stage string
+
+const (
+	// StageFramework creates the directories, module and files that are meant to be edited, such as the API
+	// files, if they do not exist
+	StageFramework Stage = "framework"
+	// StageHTTP generates the http server and client and the logical client of every API
+	StageHTTP Stage = "http"
+	// StageDependencies generates the dependencies of every logical
+	StageDependencies Stage = "dependencies"
+	// StageRuntime generates the Run function of every logical
+	StageRuntime Stage = "runtime"
+	// StagePlugins runs the generators that every logical selects in the config
+	StagePlugins Stage = "plugins"
+)
+
+// Stages are all the stages in the order they run.
+var Stages = []Stage{StageFramework, StageHTTP, StageDependencies, StageRuntime, StagePlugins}
+
+// GeneratedStages are the stages that only write generated files, which are the ones compared when checking
+// whether the output tree is up to date.
+var GeneratedStages = []Stage{StageHTTP, StageDependencies, StageRuntime, StagePlugins}
+
+var stageFuncs = map[Stage]func(e *wireup.Env) error{
+	StageFramework:    wireup.FrameworkWithFillInStrategy,
+	StageHTTP:         wireup.HttpClientServer,
+	StageDependencies: wireup.Dependencies,
+	StageRuntime:      wireup.LogicalRuntimeSetup,
+	StagePlugins:      wireup.Plugins,
+}
+
+type Options struct {
+	// Root is the directory the service is generated in
+	Root string
+	// Stages are run in the order given, all of them when empty
+	Stages []Stage
+	// DryRun records every change without making it
+	DryRun bool
+	// Force overwrites generated files even when they were edited by hand
+	Force bool
+	// Full regenerates every logical rather than only those whose inputs or outputs changed since the manifest
+	// was written. Generations of only some stages are always full and leave the manifest as it was
+	Full bool
+	// Prune removes the generated files that are no longer generated from the config, such as those of removed
+	// logicals, which needs every stage to run
+	Prune bool
+	// Removed are the names of logicals removed from the config whose directories are pruned. Files in them that
+	// were written by hand are only removed with DeleteOwned, otherwise nothing is generated and ErrOwnedFiles is
+	// returned. Pruning is implied
+	Removed []string
+	// DeleteOwned removes the files of the removed logicals that were written by hand, such as their APIs
+	DeleteOwned bool
+	// Verify type checks every package that holds generated code once generated and reports the errors as
+	// problems
+	Verify bool
+	// Parallelism bounds the number of logicals that are generated at once, which is the number of CPUs when not
+	// positive
+	Parallelism int
+	// Templates is a directory of template overrides used in place of the one in the config, which is
+	// otherwise resolved relative to the working directory
+	Templates string
+	// Log receives progress messages, nothing is logged when it is nil
+	Log func(ctx context.Context, msg string, ol ...jettison.Option)
+}
+
+// Report describes what a generation changed, or would change in a dry run.
+type Report struct {
+	// Root is the absolute path of the output tree
+	Root    string
+	Changes []ioeasy.Change
+	// HandEdited holds the absolute paths of the generated files that were left untouched since they were
+	// edited by hand
+	HandEdited []string
+	// Skipped holds the names of the logicals that were left as they were since nothing they are generated from
+	// changed
+	Skipped []string
+	// Problems are the type errors in the packages that hold generated code when verifying
+	Problems []Problem
+	// Owned holds the absolute paths of the files written by hand that keep removed logicals from being removed
+	Owned []string
+}
+
+// Stale returns the changes to files whose contents on disk differ from what was generated, including files
+// that did not exist.
+func (r Report) Stale() []ioeasy.Change {
+	var stale []ioeasy.Change
+	for _, c := range r.Changes {
+		if c.Action == ioeasy.ActionCreate || c.Action == ioeasy.ActionOverwrite {
+			stale = append(stale, c)
+		}
+	}
+
+	return stale
+}
+
+// Write writes a summary of the changes followed by a unified diff of every created or overwritten file.
+func (r Report) Write(w io.Writer) error {
+	return ioeasy.WriteReport(w, r.Root, r.Changes)
+}
+
+// Generate runs the stages on the output tree. Every file is staged until all the stages succeeded so that a
+// failure leaves the output tree as it was, and a dry run leaves it untouched. Generations share no state so they
+// may run at once, other than on the same output tree which is locked while generating.
+func Generate(ctx context.Context, c *config.Config, o Options) (Report, error) {
+	root, err := absRoot(o.Root)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if o.DryRun {
+		return generate(ctx, c, o, root)
+	}
+
+	// Locked before the manifest is read so that the tree is only planned for once no other generation runs
+	unlock, err := ioeasy.Lock(root)
+	if err != nil {
+		return Report{}, err
+	}
+
+	r, err := generate(ctx, c, o, root)
+	uerr := unlock()
+	if err == nil && uerr != nil {
+		return r, uerr
+	}
+
+	return r, err
+}
+
+func generate(ctx context.Context, c *config.Config, o Options, root string) (Report, error) {
+	stages := o.Stages
+	if len(stages) == 0 {
+		stages = Stages
+	}
+
+	for _, s := range stages {
+		if _, ok := stageFuncs[s]; !ok {
+			return Report{}, errors.Wrap(ErrUnknownStage, "", j.KV("stage", s))
+		}
+	}
+
+	logf := o.Log
+	if logf == nil {
+		logf = func(context.Context, string, ...jettison.Option) {}
+	}
+
+	dir := o.Templates
+	if dir == "" {
+		dir = c.Templates
+	}
+
+	var set *templates.Set
+	if dir != "" {
+		var err error
+		set, err = templates.LoadOverrides(dir)
+		if err != nil {
+			return Report{}, err
+		}
+	}
+
+	pruning := o.Prune || len(o.Removed) > 0
+	if pruning && len(stages) != len(Stages) {
+		return Report{}, errors.Wrap(ErrPartialPrune, "", j.KV("stages", len(stages)))
+	}
+
+	var removed []string
+	for _, name := range o.Removed {
+		removed = append(removed, filepath.Join(root, c.Service.Name, name))
+	}
+
+	if !o.DeleteOwned {
+		owned, err := ownedFiles(removed)
+		if err != nil {
+			return Report{}, err
+		}
+
+		if len(owned) > 0 {
+			r := Report{Root: root, Owned: owned}
+			return r, errors.Wrap(ErrOwnedFiles, "", j.KV("files", len(owned)))
+		}
+	}
+
+	// The output is set once it is known where the changes go
+	e := wireup.NewEnv(c, root, nil)
+	e.Parallelism = o.Parallelism
+
+	inc, err := plan(c, root, set, stages, o.Full)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// pruneThen prunes the output tree once the stages ran, when pruning
+	pruneThen := func(e *wireup.Env, changes func() []ioeasy.Change) error {
+		if !pruning {
+			return nil
+		}
+
+		n, err := prune(e, changes(), inc.kept(), removed)
+		if err != nil {
+			return err
+		}
+
+		logf(ctx, "pruned generated files", j.KV("files", n))
+		return nil
+	}
+
+	for _, name := range inc.skipped {
+		logf(ctx, "skipping unchanged logical", j.KV("logical", name))
+	}
+
+	var problems []Problem
+	if o.DryRun {
+		dr := ioeasy.NewDryRun()
+		e.Output = ioeasy.NewOutput(dr, set, o.Force)
+		err := run(ctx, e, inc.config, stages, dr.Files, logf, func(e *wireup.Env) error {
+			err := pruneThen(e, dr.Changes)
+			if err != nil {
+				return err
+			}
+
+			_, err = inc.next(e, dr.Files, dr.Changes())
+			if err != nil {
+				return err
+			}
+
+			if o.Verify {
+				problems, err = verify(e, dr.Files)
+				if err != nil {
+					return err
+				}
+			}
+
+			if !inc.tidy {
+				return nil
+			}
+
+			// Recorded so that the report shows the module would be tidied
+			return wireup.ModTidy(e)
+		})
+		r := newReport(e, dr.Changes(), inc)
+		r.Problems = problems
+		if err != nil {
+			return r, err
+		}
+
+		if len(r.HandEdited) > 0 {
+			return r, errors.Wrap(ErrHandEdited, "", j.KV("files", len(r.HandEdited)))
+		}
+
+		return r, verified(r)
+	}
+
+	// A previous generation that was killed midway left its journal behind, which is known since the lock is held
+	recovered, err := ioeasy.Recover(root)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if recovered {
+		logf(ctx, "rolled back unfinished generation", j.KV("root", root))
+	}
+
+	tx, err := ioeasy.Begin(root)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var m *manifest
+	e.Output = ioeasy.NewOutput(tx, set, o.Force)
+	err = run(ctx, e, inc.config, stages, tx.Files, logf, func(e *wireup.Env) error {
+		err := pruneThen(e, tx.Changes)
+		if err != nil {
+			return err
+		}
+
+		m, err = inc.next(e, tx.Files, tx.Changes())
+		return err
+	})
+	r := newReport(e, tx.Changes(), inc)
+	if err == nil && len(r.HandEdited) > 0 {
+		// Nothing is written so that the edits are never lost to a partial generation
+		err = errors.Wrap(ErrHandEdited, "", j.KV("files", len(r.HandEdited)))
+	}
+
+	if err != nil {
+		rerr := tx.Rollback()
+		if rerr != nil {
+			return r, errors.Wrap(rerr, "unable to roll back failed generation", j.KV("generate_error", err.Error()))
+		}
+
+		return r, err
+	}
+
+	err = tx.CommitThen(func() error {
+		if !inc.tidy {
+			return nil
+		}
+
+		// The module is tidied once the generated code is in place, and rolled back with it on failure
+		logf(ctx, "tidying module", j.KV("root", root))
+		return wireup.ModTidy(e)
+	})
+	if err != nil {
+		return r, err
+	}
+
+	r.Changes = ioeasy.SortChanges(tx.Changes())
+	if m != nil {
+		err = m.write(root)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	logf(ctx, "generated", j.MKV{"root": root, "changes": len(r.Stale())})
+
+	if o.Verify {
+		// The files are in place so the packages are read from disk, along with the module requirements
+		r.Problems, err = verify(e, nil)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	return r, verified(r)
+}
+
+// verified returns ErrVerify if the report lists problems.
+func verified(r Report) error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+
+	return errors.Wrap(ErrVerify, "", j.KV("problems", len(r.Problems)))
+}
+
+// newReport returns the report of the changes, which are ordered by path like the hand edited files so that the
+// report does not depend on the order the logicals were generated in.
+func newReport(e *wireup.Env, changes []ioeasy.Change, inc *incremental) Report {
+	handEdited := e.Output.HandEdited()
+	sort.Strings(handEdited)
+
+	return Report{
+		Root:       e.Root,
+		Changes:    ioeasy.SortChanges(changes),
+		HandEdited: handEdited,
+		Skipped:    inc.skipped,
+	}
+}
+
+func absRoot(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", errors.Wrap(err, "", j.KV("root", root))
+	}
+
+	return abs, nil
+}
+
+// run runs the stages for the logicals of the config and then with every change going to the output of the env and
+// every read of the output tree seeing the files staged in it.
+func run(ctx context.Context, e *wireup.Env, c *config.Config, stages []Stage, staged map[string][]byte,
+	logf func(ctx context.Context, msg string, ol ...jettison.Option), then func(e *wireup.Env) error) error {
+
+	for _, s := range stages {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrap(err, "")
+		}
+
+		logf(ctx, "running stage", j.KV("stage", s))
+
+		// Logicals generated in parallel only read the files staged by the stages before, never those of each
+		// other, so that what they read does not depend on the order they run in
+		se := *e
+		se.Config = c
+		se.Loader = e.Loader.WithOverlay(snapshot(staged))
+
+		err := stageFuncs[s](&se)
+		if err != nil {
+			return errors.Wrap(err, "", j.KV("stage", s))
+		}
+	}
+
+	te := *e
+	te.Loader = e.Loader.WithOverlay(staged)
+	return then(&te)
+}
+
+func snapshot(staged map[string][]byte) map[string][]byte {
+	files := make(map[string][]byte, len(staged))
+	for path, b := range staged {
+		files[path] = b
+	}
+
+	return files
+}
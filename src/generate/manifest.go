@@ -0,0 +1,514 @@
+package generate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"gomicro/config"
+	"gomicro/ioeasy"
+	"gomicro/templates"
+	"gomicro/wireup"
+)
+
+// manifestPath is where the manifest is kept relative to the root of the output tree.
+const manifestPath = ".gomicro/manifest"
+
+// manifestVersion is bumped whenever the format of the manifest changes, which invalidates older manifests.
+const manifestVersion = 1
+
+// manifest records the inputs and outputs of the last generation so that the next one only regenerates the
+// logicals whose inputs or outputs changed since. Paths are relative to the root of the output tree with forward
+// slashes.
+type manifest struct {
+	Version int `json:"version"`
+	// Generator fingerprints the generator and the templates it used
+	Generator string `json:"generator"`
+	// Imports hashes the import paths of the service which decides whether the module is tidied
+	Imports  string                   `json:"imports"`
+	Logicals map[string]logicalRecord `json:"logicals"`
+}
+
+type logicalRecord struct {
+	// Config hashes the configuration of the logical
+	Config string `json:"config"`
+	// Inputs hold the hash of every file the generated code depends on keyed by path
+	Inputs map[string]string `json:"inputs"`
+	// Outputs hold the hash of every generated file keyed by path
+	Outputs map[string]string `json:"outputs"`
+}
+
+// readManifest returns the manifest of the output tree at root or nil if there is none or it is of another
+// version.
+func readManifest(root string) (*manifest, error) {
+	path := filepath.Join(root, filepath.FromSlash(manifestPath))
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	var m manifest
+	err = json.Unmarshal(b, &m)
+	if err != nil || m.Version != manifestVersion {
+		// An unreadable manifest only costs a full generation
+		return nil, nil
+	}
+
+	return &m, nil
+}
+
+func (m *manifest) write(root string) error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	path := filepath.Join(root, filepath.FromSlash(manifestPath))
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	return ioeasy.WriteAtomic(path, append(b, '\n'))
+}
+
+// incremental decides which logicals are generated and whether the module is tidied from the manifest of the
+// last generation.
+type incremental struct {
+	c    *config.Config
+	root string
+	// generator fingerprints the generator and the templates of the generation
+	generator string
+	// config is a copy of the config with only the logicals that are generated
+	config  *config.Config
+	skipped []string
+	// tidy is true when the module is tidied after the stages ran, which is only known once they did
+	tidy bool
+
+	// manifest is false when the manifest is neither used nor written
+	manifest bool
+	prev     *manifest
+	// module is true when go.mod existed before the stages ran
+	module bool
+}
+
+// plan returns the generation of the stages with the set of templates. Every logical is generated unless all the
+// stages run, full is false and a manifest of a generation by the same generator and templates exists.
+func plan(c *config.Config, root string, set *templates.Set, stages []Stage, full bool) (*incremental, error) {
+	inc := &incremental{c: c, root: root, generator: generatorFingerprint(set), config: c}
+
+	framework := false
+	for _, s := range stages {
+		framework = framework || s == StageFramework
+	}
+
+	inc.manifest = !full && len(stages) == len(Stages)
+	if !inc.manifest {
+		inc.tidy = framework
+		return inc, nil
+	}
+
+	_, err := os.Stat(filepath.Join(root, "go.mod"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "", j.KV("root", root))
+	}
+	inc.module = err == nil
+
+	prev, err := readManifest(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if prev == nil || prev.Generator != inc.generator {
+		return inc, nil
+	}
+	inc.prev = prev
+
+	cp := *c
+	cp.Service.Logicals = nil
+	for _, logical := range c.Service.Logicals {
+		changed, err := prev.changed(c, root, logical)
+		if err != nil {
+			return nil, err
+		}
+
+		if changed {
+			cp.Service.Logicals = append(cp.Service.Logicals, logical)
+		} else {
+			inc.skipped = append(inc.skipped, logical.Name)
+		}
+	}
+	inc.config = &cp
+
+	return inc, nil
+}
+
+// next returns the manifest to write once the staged files and changes are, or nil if none is written, and
+// decides whether the module is tidied. The env reads the staged files.
+func (inc *incremental) next(e *wireup.Env, staged map[string][]byte, changes []ioeasy.Change) (*manifest, error) {
+	if !inc.manifest {
+		return nil, nil
+	}
+
+	imports, err := importsHash(inc.c, inc.root, staged, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only imports decide what the module requires
+	inc.tidy = inc.prev == nil || inc.prev.Imports != imports || !inc.module
+
+	m := &manifest{
+		Version:   manifestVersion,
+		Generator: inc.generator,
+		Imports:   imports,
+		Logicals:  make(map[string]logicalRecord),
+	}
+
+	skipped := make(map[string]bool)
+	for _, name := range inc.skipped {
+		skipped[name] = true
+	}
+
+	for _, logical := range inc.c.Service.Logicals {
+		if skipped[logical.Name] {
+			m.Logicals[logical.Name] = inc.prev.Logicals[logical.Name]
+			continue
+		}
+
+		rec, err := record(e, logical, staged, changes)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Logicals[logical.Name] = rec
+	}
+
+	return m, nil
+}
+
+// kept returns the absolute paths of the generated files of the skipped logicals, which were not written.
+func (inc *incremental) kept() []string {
+	var paths []string
+	for _, name := range inc.skipped {
+		for path := range inc.prev.Logicals[name].Outputs {
+			paths = append(paths, filepath.Join(inc.root, filepath.FromSlash(path)))
+		}
+	}
+
+	return paths
+}
+
+// changed returns true if the logical has to be regenerated since its config, its inputs or its outputs differ
+// from the ones recorded.
+func (m *manifest) changed(c *config.Config, root string, logical config.Logical) (bool, error) {
+	rec, ok := m.Logicals[logical.Name]
+	if !ok || rec.Config != configHash(c, logical) {
+		return true, nil
+	}
+
+	// Files added to the API package are inputs too
+	files, err := packageFiles(filepath.Join(root, c.Service.Name, logical.Name), nil)
+	if err != nil {
+		return false, err
+	}
+
+	for _, path := range files {
+		if _, ok := rec.Inputs[relPath(root, path)]; !ok {
+			return true, nil
+		}
+	}
+
+	for _, files := range []map[string]string{rec.Inputs, rec.Outputs} {
+		for path, sum := range files {
+			b, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+			if os.IsNotExist(err) {
+				return true, nil
+			} else if err != nil {
+				return false, errors.Wrap(err, "", j.KV("path", path))
+			}
+
+			if hash(b) != sum {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// record returns the record of the logical after it was generated. Files are read from the staged files before
+// the disk.
+func record(e *wireup.Env, logical config.Logical, staged map[string][]byte, changes []ioeasy.Change) (logicalRecord,
+	error) {
+
+	c, root := e.Config, e.Root
+	rec := logicalRecord{
+		Config:  configHash(c, logical),
+		Inputs:  make(map[string]string),
+		Outputs: make(map[string]string),
+	}
+
+	dir := filepath.Join(root, c.Service.Name, logical.Name)
+	files, err := packageFiles(dir, staged)
+	if err != nil {
+		return logicalRecord{}, err
+	}
+
+	inputs, err := wireup.Inputs(e, logical)
+	if err != nil {
+		return logicalRecord{}, err
+	}
+
+	for _, path := range inputs {
+		// Files outside the output tree, such as those of the standard library, do not change between runs
+		if strings.HasPrefix(relPath(root, path), "../") {
+			continue
+		}
+
+		files = append(files, path)
+	}
+
+	for _, path := range files {
+		b, err := readStaged(path, staged)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return logicalRecord{}, err
+		}
+
+		// Generated files in the API package are outputs
+		if ioeasy.IsGenerated(b) {
+			continue
+		}
+
+		rec.Inputs[relPath(root, path)] = hash(b)
+	}
+
+	outputs, err := wireup.Outputs(e, logical)
+	if err != nil {
+		return logicalRecord{}, err
+	}
+
+	for _, path := range outputs {
+		b, err := readStaged(path, staged)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return logicalRecord{}, err
+		}
+
+		rec.Outputs[relPath(root, path)] = hash(b)
+	}
+
+	// Generated files that the generators do not declare are outputs too
+	for _, ch := range changes {
+		if !within(dir, ch.Path) || !ioeasy.IsGenerated(ch.New) {
+			continue
+		}
+
+		rec.Outputs[relPath(root, ch.Path)] = hash(ch.New)
+	}
+
+	return rec, nil
+}
+
+// packageFiles returns the go files of the package in dir that the generator reads, excluding tests, from the
+// staged files and the disk.
+func packageFiles(dir string, staged map[string][]byte) ([]string, error) {
+	seen := make(map[string]bool)
+	for path := range staged {
+		if filepath.Dir(path) == dir && isSource(path) {
+			seen[path] = true
+		}
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "", j.KV("dir", dir))
+	}
+
+	for _, info := range infos {
+		path := filepath.Join(dir, info.Name())
+		if info.IsDir() || !isSource(path) {
+			continue
+		}
+
+		b, err := readStaged(path, staged)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ioeasy.IsGenerated(b) {
+			seen[path] = true
+		}
+	}
+
+	var files []string
+	for path := range seen {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func isSource(path string) bool {
+	return strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go")
+}
+
+// importsHash hashes the import paths of every go file of the service, which only changes when the module may
+// need to be tidied. Files that the changes remove are left out.
+func importsHash(c *config.Config, root string, staged map[string][]byte, changes []ioeasy.Change) (string, error) {
+	dir := filepath.Join(root, c.Service.Name)
+
+	removed := make(map[string]bool)
+	for _, ch := range changes {
+		if ch.Action == ioeasy.ActionRemove {
+			removed[ch.Path] = true
+		}
+	}
+
+	files := make(map[string]bool)
+	for path := range staged {
+		if within(dir, path) && isSource(path) {
+			files[path] = true
+		}
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if info.IsDir() && path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && isSource(path) && !removed[path] {
+			files[path] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "", j.KV("dir", dir))
+	}
+
+	imports := make(map[string]bool)
+	fset := token.NewFileSet()
+	for path := range files {
+		b, err := readStaged(path, staged)
+		if err != nil {
+			return "", err
+		}
+
+		f, err := parser.ParseFile(fset, path, b, parser.ImportsOnly)
+		if err != nil {
+			// Files that do not parse are left for the build to report
+			continue
+		}
+
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err == nil {
+				imports[path] = true
+			}
+		}
+	}
+
+	var paths []string
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return hash([]byte(strings.Join(paths, "\n"))), nil
+}
+
+func readStaged(path string, staged map[string][]byte) ([]byte, error) {
+	if b, ok := staged[path]; ok {
+		return b, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	return b, nil
+}
+
+func configHash(c *config.Config, logical config.Logical) string {
+	b, err := json.Marshal(struct {
+		Module  string
+		Service string
+		Logical config.Logical
+	}{c.Module, c.Service.Name, logical})
+	if err != nil {
+		// The config only holds strings, bools and slices of them
+		panic(err)
+	}
+
+	return hash(b)
+}
+
+var (
+	executableOnce sync.Once
+	executableHash string
+)
+
+// generatorFingerprint returns a hash of the running generator and the set of templates so that a new version of
+// either regenerates everything.
+func generatorFingerprint(set *templates.Set) string {
+	executableOnce.Do(func() {
+		// Without the executable the fingerprint still covers the templates
+		path, err := os.Executable()
+		if err != nil {
+			return
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return
+		}
+
+		executableHash = hash(b)
+	})
+
+	return hash([]byte(executableHash + set.Fingerprint()))
+}
+
+func hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func within(dir, path string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func relPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,183 @@
+package generate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gomicro/config"
+)
+
+// testConfig returns the config of a service with a logical for each name. It has no module so that generating it
+// never runs go commands.
+func testConfig(names ...string) *config.Config {
+	c := &config.Config{Service: config.Service{Name: "apollo"}}
+	for _, name := range names {
+		c.Service.Logicals = append(c.Service.Logicals, config.Logical{
+			Name: name,
+			API: config.API{
+				FileName:      "api.go",
+				InterfaceName: "API",
+				Implementations: config.APIImplementation{
+					Local: true,
+					HTTP:  true,
+				},
+			},
+		})
+	}
+
+	return c
+}
+
+// testGenerate generates the config in the output tree at o.Root and fails on any error.
+func testGenerate(t *testing.T, c *config.Config, o Options) Report {
+	t.Helper()
+
+	r, err := Generate(context.Background(), c, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+
+	err := ioutil.WriteFile(path, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertSkipped(t *testing.T, r Report, want ...string) {
+	t.Helper()
+
+	if !reflect.DeepEqual(r.Skipped, want) {
+		t.Errorf("skipped %v, want %v", r.Skipped, want)
+	}
+}
+
+func TestGenerateSkipsUnchanged(t *testing.T) {
+	root := t.TempDir()
+	c := testConfig("users", "rooms")
+
+	r := testGenerate(t, c, Options{Root: root})
+	assertSkipped(t, r)
+
+	if len(r.Stale()) == 0 {
+		t.Fatal("nothing generated")
+	}
+
+	_, err := os.Stat(filepath.Join(root, filepath.FromSlash(manifestPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = testGenerate(t, c, Options{Root: root})
+	assertSkipped(t, r, "users", "rooms")
+
+	if len(r.Stale()) > 0 {
+		t.Errorf("%d files changed, want none", len(r.Stale()))
+	}
+
+	r = testGenerate(t, c, Options{Root: root, Full: true})
+	assertSkipped(t, r)
+
+	if len(r.Stale()) > 0 {
+		t.Errorf("%d files changed by a full generation, want none", len(r.Stale()))
+	}
+}
+
+func TestGenerateRegeneratesChangedAPI(t *testing.T) {
+	root := t.TempDir()
+	c := testConfig("users", "rooms")
+	testGenerate(t, c, Options{Root: root})
+
+	writeFile(t, filepath.Join(root, "apollo", "users", "api.go"), `package users
+
+import "context"
+
+type API interface {
+	Ping(ctx context.Context) error
+}
+`)
+
+	r := testGenerate(t, c, Options{Root: root})
+	assertSkipped(t, r, "rooms")
+
+	server := readFile(t, filepath.Join(root, "apollo", "users", "server", "server_gen.go"))
+	if !strings.Contains(server, "Ping") {
+		t.Error("server of the changed API not regenerated")
+	}
+
+	r = testGenerate(t, c, Options{Root: root})
+	assertSkipped(t, r, "users", "rooms")
+}
+
+func TestGenerateRegeneratesChangedOutput(t *testing.T) {
+	root := t.TempDir()
+	c := testConfig("users", "rooms")
+	testGenerate(t, c, Options{Root: root})
+
+	path := filepath.Join(root, "apollo", "rooms", "client", "logical", "client_gen.go")
+	want := readFile(t, path)
+
+	err := os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := testGenerate(t, c, Options{Root: root})
+	assertSkipped(t, r, "users")
+
+	if readFile(t, path) != want {
+		t.Error("removed output not restored")
+	}
+}
+
+func TestGenerateRegeneratesChangedConfig(t *testing.T) {
+	root := t.TempDir()
+	c := testConfig("users", "rooms")
+	testGenerate(t, c, Options{Root: root})
+
+	c.Service.Logicals[1].Dependencies = []config.Dep{{Name: "MainDB", Path: "database/sql", Type: "*sql.DB"}}
+
+	r := testGenerate(t, c, Options{Root: root})
+	assertSkipped(t, r, "users")
+
+	deps := readFile(t, filepath.Join(root, "apollo", "rooms", "dependencies", "dependencies.go"))
+	if !strings.Contains(deps, "MainDB") {
+		t.Error("dependencies of the changed logical not regenerated")
+	}
+}
+
+func TestGenerateSomeStagesKeepsManifest(t *testing.T) {
+	root := t.TempDir()
+	c := testConfig("users", "rooms")
+	testGenerate(t, c, Options{Root: root})
+
+	path := filepath.Join(root, filepath.FromSlash(manifestPath))
+	want := readFile(t, path)
+
+	testGenerate(t, c, Options{Root: root, Stages: []Stage{StageDependencies}})
+
+	if readFile(t, path) != want {
+		t.Error("manifest changed by a generation of some stages")
+	}
+}
@@ -0,0 +1,210 @@
+package generate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"gomicro/ioeasy"
+	"gomicro/wireup"
+)
+
+// ErrPartialPrune is returned when pruning is asked for along with only some of the stages, which do not write
+// every file the generator owns.
+var ErrPartialPrune = errors.New("pruning needs every stage to run", errors.WithoutStackTrace())
+
+// ErrOwnedFiles is returned when logicals are removed whose directories hold files written by hand, which are
+// kept unless deleting them is asked for. Nothing is written in that case and the report lists the files.
+var ErrOwnedFiles = errors.New("removed logicals hold files written by hand", errors.WithoutStackTrace())
+
+// prune removes the generated files of the service that the generation did not write, such as those of logicals
+// and interfaces removed from the config, along with the directories that are left empty. The generated header
+// marks the files the generator owns so that files written by hand, such as server/server.go, are never removed
+// other than those of removed logicals when deleting them was asked for.
+// Kept holds the absolute paths of generated files that were not written since their logical was skipped, and
+// removed the directories of logicals removed from the config, which are removed whole since either they only hold
+// generated files or deleting the others was asked for. It returns the number of files removed.
+func prune(e *wireup.Env, changes []ioeasy.Change, kept, removed []string) (int, error) {
+	owned := make(map[string]bool)
+	for _, ch := range changes {
+		owned[ch.Path] = true
+	}
+
+	for _, path := range kept {
+		owned[path] = true
+	}
+
+	dir := filepath.Join(e.Root, e.Config.Service.Name)
+
+	var stale []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if info.IsDir() && path != dir && strings.HasPrefix(info.Name(), ".") && !withinAny(removed, path) {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() || owned[path] {
+			return nil
+		}
+
+		if withinAny(removed, path) {
+			stale = append(stale, path)
+			return nil
+		}
+
+		if !isSource(path) {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if ioeasy.IsGenerated(b) {
+			stale = append(stale, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "", j.KV("dir", dir))
+	}
+
+	gone := make(map[string]bool)
+	for _, path := range stale {
+		err := e.Output.Remove(path)
+		if err != nil {
+			return 0, err
+		}
+
+		gone[path] = true
+	}
+
+	// Hand edited files were kept so their directories are too, and the generation fails regardless
+	if len(e.Output.HandEdited()) > 0 {
+		return 0, nil
+	}
+
+	empty, err := emptyDirs(dir, stale, gone, owned)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, path := range empty {
+		err := e.Output.RemoveDir(path)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(stale), nil
+}
+
+// emptyDirs returns the directories below dir, deepest first, that only held the removed files and directories.
+// Directories that the generation wrote to are never empty.
+func emptyDirs(dir string, stale []string, removed, owned map[string]bool) ([]string, error) {
+	written := make(map[string]bool)
+	for path := range owned {
+		written[filepath.Dir(path)] = true
+	}
+
+	candidates := make(map[string]bool)
+	for _, path := range stale {
+		for d := filepath.Dir(path); within(dir, d); d = filepath.Dir(d) {
+			candidates[d] = true
+		}
+	}
+
+	var dirs []string
+	for d := range candidates {
+		dirs = append(dirs, d)
+	}
+
+	// Deeper directories are decided first since their parents are only empty once they are removed
+	sort.Slice(dirs, func(i, j int) bool {
+		return len(dirs[i]) > len(dirs[j])
+	})
+
+	var empty []string
+	for _, d := range dirs {
+		if written[d] || owned[d] {
+			continue
+		}
+
+		infos, err := ioutil.ReadDir(d)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("dir", d))
+		}
+
+		left := false
+		for _, info := range infos {
+			left = left || !removed[filepath.Join(d, info.Name())]
+		}
+
+		if left {
+			continue
+		}
+
+		removed[d] = true
+		empty = append(empty, d)
+	}
+
+	return empty, nil
+}
+
+// withinAny returns true if path is below any of the directories.
+func withinAny(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if within(dir, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ownedFiles returns the files below the directories that were written by hand, being every file without the
+// generated header.
+func ownedFiles(dirs []string) ([]string, error) {
+	var owned []string
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			if !ioeasy.IsGenerated(b) {
+				owned = append(owned, path)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("dir", dir))
+		}
+	}
+
+	return owned, nil
+}
@@ -0,0 +1,143 @@
+package generate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luno/jettison/errors"
+
+	"gomicro/ioeasy"
+)
+
+// generatedFiles returns the files below dir that hold the generated header.
+func generatedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var generated []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		if ioeasy.IsGenerated([]byte(readFile(t, path))) {
+			generated = append(generated, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return generated
+}
+
+func assertExists(t *testing.T, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("%s removed, want it kept", path)
+		}
+	}
+}
+
+func TestPruneKeepsOwnedFiles(t *testing.T) {
+	root := t.TempDir()
+	testGenerate(t, testConfig("users", "rooms"), Options{Root: root})
+
+	rooms := filepath.Join(root, "apollo", "rooms")
+	users := filepath.Join(root, "apollo", "users")
+	writeFile(t, filepath.Join(rooms, "extra.go"), "package rooms\n")
+	writeFile(t, filepath.Join(rooms, "client", "notes.txt"), "notes\n")
+	kept := generatedFiles(t, users)
+
+	// A generated file that is no longer generated, such as that of an implementation removed from the config
+	stale := filepath.Join(users, "client", "grpc", "client_gen.go")
+	err := os.MkdirAll(filepath.Dir(stale), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, stale, readFile(t, filepath.Join(users, "client", "logical", "client_gen.go")))
+
+	r := testGenerate(t, testConfig("users"), Options{Root: root, Prune: true})
+
+	if len(generatedFiles(t, rooms)) > 0 {
+		t.Errorf("generated files of the removed logical kept: %v", generatedFiles(t, rooms))
+	}
+
+	assertExists(t,
+		filepath.Join(rooms, "api.go"),
+		filepath.Join(rooms, "server", "server.go"),
+		filepath.Join(rooms, "extra.go"),
+		filepath.Join(rooms, "client", "notes.txt"),
+	)
+
+	_, err = os.Stat(filepath.Join(rooms, "dependencies"))
+	if !os.IsNotExist(err) {
+		t.Error("directory left empty by pruning kept")
+	}
+
+	_, err = os.Stat(filepath.Dir(stale))
+	if !os.IsNotExist(err) {
+		t.Error("generated file that is no longer generated kept")
+	}
+
+	assertExists(t, kept...)
+
+	var removed int
+	for _, c := range r.Changes {
+		if c.Action == ioeasy.ActionRemove {
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		t.Error("no removals reported")
+	}
+}
+
+func TestPruneNeedsEveryStage(t *testing.T) {
+	root := t.TempDir()
+
+	_, err := Generate(context.Background(), testConfig("users"), Options{
+		Root:   root,
+		Prune:  true,
+		Stages: []Stage{StageDependencies},
+	})
+	if !errors.Is(err, ErrPartialPrune) {
+		t.Fatalf("got error %v, want %v", err, ErrPartialPrune)
+	}
+}
+
+func TestRemovedLogicalKeepsOwnedFiles(t *testing.T) {
+	root := t.TempDir()
+	testGenerate(t, testConfig("users", "rooms"), Options{Root: root})
+
+	rooms := filepath.Join(root, "apollo", "rooms")
+	writeFile(t, filepath.Join(rooms, "extra.go"), "package rooms\n")
+	generated := generatedFiles(t, rooms)
+
+	r, err := Generate(context.Background(), testConfig("users"), Options{Root: root, Removed: []string{"rooms"}})
+	if !errors.Is(err, ErrOwnedFiles) {
+		t.Fatalf("got error %v, want %v", err, ErrOwnedFiles)
+	}
+
+	if len(r.Owned) != 3 {
+		t.Errorf("owned files %v, want the API, the server and extra.go", r.Owned)
+	}
+
+	// Nothing is written when the removal is refused
+	assertExists(t, generated...)
+	assertExists(t, r.Owned...)
+
+	testGenerate(t, testConfig("users"), Options{Root: root, Removed: []string{"rooms"}, DeleteOwned: true})
+
+	_, err = os.Stat(rooms)
+	if !os.IsNotExist(err) {
+		t.Error("directory of the removed logical kept")
+	}
+}
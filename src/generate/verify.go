@@ -0,0 +1,237 @@
+package generate
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"gomicro/ioeasy"
+	"gomicro/templates"
+	"gomicro/wireup"
+)
+
+// ErrVerify is returned when the generated code does not compile. The generated files are written regardless
+// since the errors are often in files that are meant to be edited, and the report lists the problems.
+var ErrVerify = errors.New("generated code does not compile", errors.WithoutStackTrace())
+
+// Problem is a type error in a package of the service that holds generated code.
+type Problem struct {
+	Pos     token.Position
+	Message string
+	// Decl is the name of the top-level declaration the error is in
+	Decl string
+	// Origin is the template that rendered the declaration, which is empty when the file is not generated or
+	// was not written by the generation, such as the files of skipped logicals
+	Origin templates.Origin
+}
+
+// String returns the problem with the path of its position relative to root.
+func (p Problem) String(root string) string {
+	pos := p.Pos
+	pos.Filename = relPath(root, pos.Filename)
+
+	s := fmt.Sprintf("%s: %s", pos, p.Message)
+	switch {
+	case p.Origin.Method != "":
+		return fmt.Sprintf("%s (in %s from template %s for method %s)", s, p.Decl, p.Origin.Template, p.Origin.Method)
+	case p.Origin.Template != "":
+		return fmt.Sprintf("%s (in %s from template %s)", s, p.Decl, p.Origin.Template)
+	case p.Decl != "":
+		return fmt.Sprintf("%s (in %s)", s, p.Decl)
+	}
+
+	return s
+}
+
+// verify type checks every package of the service that holds generated files and returns the type errors in
+// them, mapped to the templates that rendered the declarations they are in. Files are read from the staged files
+// before the disk.
+func verify(e *wireup.Env, staged map[string][]byte) ([]Problem, error) {
+	dirs, err := generatedDirs(filepath.Join(e.Root, e.Config.Service.Name), staged)
+	if err != nil {
+		return nil, err
+	}
+
+	typeErrs, err := e.Loader.CheckPackages(dirs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	for _, te := range typeErrs {
+		p := Problem{Pos: te.Fset.Position(te.Pos), Message: te.Msg}
+
+		p.Decl, p.Origin, err = origin(e.Output, p.Pos, staged)
+		if err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, p)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Pos.Filename != problems[j].Pos.Filename {
+			return problems[i].Pos.Filename < problems[j].Pos.Filename
+		}
+
+		return problems[i].Pos.Line < problems[j].Pos.Line
+	})
+
+	return problems, nil
+}
+
+// generatedDirs returns the directories below dir in order that hold generated go files.
+func generatedDirs(dir string, staged map[string][]byte) ([]string, error) {
+	files := make(map[string]bool)
+	for path := range staged {
+		if within(dir, path) && isSource(path) {
+			files[path] = true
+		}
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if info.IsDir() && path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && isSource(path) {
+			files[path] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("dir", dir))
+	}
+
+	seen := make(map[string]bool)
+	var dirs []string
+	for path := range files {
+		if seen[filepath.Dir(path)] {
+			continue
+		}
+
+		b, err := readStaged(path, staged)
+		if err != nil {
+			return nil, err
+		}
+
+		if ioeasy.IsGenerated(b) {
+			seen[filepath.Dir(path)] = true
+			dirs = append(dirs, filepath.Dir(path))
+		}
+	}
+	sort.Strings(dirs)
+
+	return dirs, nil
+}
+
+// origin returns the name of the top-level declaration at the position and the template that rendered it when the
+// file was generated by this run to the output.
+func origin(out *ioeasy.Output, pos token.Position, staged map[string][]byte) (string, templates.Origin, error) {
+	b, ok := staged[pos.Filename]
+	if !ok {
+		var err error
+		b, err = ioutil.ReadFile(pos.Filename)
+		if err != nil {
+			return "", templates.Origin{}, errors.Wrap(err, "", j.KV("path", pos.Filename))
+		}
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, pos.Filename, b, 0)
+	if err != nil {
+		return "", templates.Origin{}, errors.Wrap(err, "", j.KV("path", pos.Filename))
+	}
+
+	// Declarations are counted without imports like the origins of a file config
+	index := -1
+	decls := declarations(f)
+	for i, decl := range decls {
+		if fset.Position(decl.Pos()).Line <= pos.Line && pos.Line <= fset.Position(decl.End()).Line {
+			index = i
+			break
+		}
+	}
+
+	if index < 0 {
+		return "", templates.Origin{}, nil
+	}
+
+	name := declName(decls[index])
+
+	fc, ok := out.Rendered(pos.Filename)
+	if !ok {
+		return name, templates.Origin{}, nil
+	}
+
+	origins, err := fc.Origins(out.Templates())
+	if err != nil {
+		return "", templates.Origin{}, err
+	}
+
+	if index >= len(origins) {
+		return name, templates.Origin{}, nil
+	}
+
+	return name, origins[index], nil
+}
+
+// declarations returns the top-level declarations of the file other than imports.
+func declarations(f *ast.File) []ast.Decl {
+	var decls []ast.Decl
+	for _, decl := range f.Decls {
+		if gd, ok := decl.(*ast.GenDecl); !ok || gd.Tok != token.IMPORT {
+			decls = append(decls, decl)
+		}
+	}
+
+	return decls
+}
+
+// declName returns the name of the declaration, with the receiver type for methods.
+func declName(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv == nil || len(d.Recv.List) == 0 {
+			return d.Name.Name
+		}
+
+		typ := d.Recv.List[0].Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+
+		if id, ok := typ.(*ast.Ident); ok {
+			return id.Name + "." + d.Name.Name
+		}
+
+		return d.Name.Name
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				return s.Name.Name
+			case *ast.ValueSpec:
+				return s.Names[0].Name
+			}
+		}
+	}
+
+	return ""
+}
@@ -1,9 +1,18 @@
 module gomicro
 
-go 1.15
+go 1.23
 
 require (
 	github.com/luno/jettison v0.0.0-20210218093327-95083f929b49
-	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/golang/protobuf v1.3.2 // indirect
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110 // indirect
+	golang.org/x/xerrors v0.0.0-20190717185122-a985d3407aa7 // indirect
+	google.golang.org/genproto v0.0.0-20180817151627-c66870c02cf8 // indirect
+	google.golang.org/grpc v1.22.1 // indirect
 )
@@ -0,0 +1,185 @@
+package ioeasy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+type edit struct {
+	// op is ' ' for a line in both files, '-' for a removed line and '+' for an added line
+	op   byte
+	line string
+}
+
+// unifiedDiff returns the changes from old to new in the unified format or an empty string when they are equal.
+func unifiedDiff(oldName, newName string, old, new []byte) string {
+	edits := diffLines(splitLines(string(old)), splitLines(string(new)))
+
+	var b strings.Builder
+	for _, h := range hunks(edits) {
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.oldStart, h.oldLines), hunkRange(h.newStart, h.newLines))
+		for _, e := range edits[h.from:h.to] {
+			b.WriteByte(e.op)
+			b.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	// The last element is empty when s ends in a new line
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffLines returns the edits that turn a into b using the longest common subsequence of their lines. Common
+// leading and trailing lines are matched first to keep the table small.
+func diffLines(a, b []string) []edit {
+	var prefix, suffix []edit
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, edit{op: ' ', line: a[0]})
+		a, b = a[1:], b[1:]
+	}
+
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]edit{{op: ' ', line: a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	edits := prefix
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{op: ' ', line: a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{op: '-', line: a[i]})
+			i++
+		default:
+			edits = append(edits, edit{op: '+', line: b[j]})
+			j++
+		}
+	}
+
+	return append(edits, suffix...)
+}
+
+type hunk struct {
+	// from and to are the range of edits in the hunk
+	from, to           int
+	oldStart, oldLines int
+	newStart, newLines int
+}
+
+// hunks groups the changed lines with their surrounding context, merging changes whose context overlaps.
+func hunks(edits []edit) []hunk {
+	var hs []hunk
+	for i := 0; i < len(edits); i++ {
+		if edits[i].op == ' ' {
+			continue
+		}
+
+		from := i - diffContext
+		if from < 0 {
+			from = 0
+		}
+
+		// Extend the hunk while the next change is within twice the context
+		to := i
+		for k := i; k < len(edits) && k <= to+2*diffContext; k++ {
+			if edits[k].op != ' ' {
+				to = k
+			}
+		}
+
+		end := to + 1 + diffContext
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		hs = append(hs, hunk{from: from, to: end})
+		i = end - 1
+	}
+
+	// Number the lines of each hunk in the old and new files
+	oldLine, newLine, next := 1, 1, 0
+	for i, e := range edits {
+		if next < len(hs) && hs[next].from == i {
+			hs[next].oldStart, hs[next].newStart = oldLine, newLine
+		}
+
+		if next < len(hs) && i >= hs[next].from && i < hs[next].to {
+			if e.op != '+' {
+				hs[next].oldLines++
+			}
+			if e.op != '-' {
+				hs[next].newLines++
+			}
+		}
+
+		if e.op != '+' {
+			oldLine++
+		}
+		if e.op != '-' {
+			newLine++
+		}
+
+		if next < len(hs) && i == hs[next].to-1 {
+			next++
+		}
+	}
+
+	return hs
+}
+
+// hunkRange formats the start and length of a hunk where an empty range starts at the line before it.
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		start--
+	}
+
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, lines)
+}
@@ -0,0 +1,294 @@
+package ioeasy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+)
+
+// Action is what a change does to the output tree.
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionOverwrite Action = "overwrite"
+	ActionUnchanged Action = "unchanged"
+	// ActionKeep is an existing file that the generator does not overwrite
+	ActionKeep  Action = "keep"
+	ActionMkdir Action = "mkdir"
+	// ActionRemove is a file and ActionRmdir an empty directory that the generator removes
+	ActionRemove Action = "remove"
+	ActionRmdir  Action = "rmdir"
+	ActionRun    Action = "run"
+)
+
+// Change is a single change to the output tree.
+type Change struct {
+	Action Action
+	// Path is the absolute path of the file or directory, or the directory a command runs in
+	Path string
+	// Old holds the contents of the file on disk and New what the generator would write
+	Old []byte
+	New []byte
+	// Command is the command that would run
+	Command string
+}
+
+// DryRun is a Sink that records the changes the generator would make without touching the output tree. It is
+// safe to use from logicals generated in parallel.
+type DryRun struct {
+	// Files holds the contents every written file would have, keyed by absolute path, which is used as an overlay
+	// when reading the output tree. It may only be read while no changes are being made.
+	Files map[string][]byte
+
+	mu sync.Mutex
+
+	changes []Change
+	// files maps the absolute path of a file to its change
+	files map[string]int
+	dirs  map[string]bool
+	// removed holds the files and directories that would be removed
+	removed map[string]bool
+}
+
+func NewDryRun() *DryRun {
+	return &DryRun{
+		Files:   make(map[string][]byte),
+		files:   make(map[string]int),
+		dirs:    make(map[string]bool),
+		removed: make(map[string]bool),
+	}
+}
+
+func (d *DryRun) Exists(path string) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, errors.Wrap(err, "")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.Files[abs]; ok || d.dirs[abs] {
+		return true, nil
+	}
+
+	if d.removed[abs] {
+		return false, nil
+	}
+
+	return Disk{}.Exists(abs)
+}
+
+func (d *DryRun) Mkdir(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dirs[abs] = true
+	d.changes = append(d.changes, Change{Action: ActionMkdir, Path: abs})
+	return nil
+}
+
+func (d *DryRun) WriteFile(path string, b []byte, overwrite bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Files written more than once keep their original contents to compare against
+	if i, ok := d.files[abs]; ok {
+		if !overwrite {
+			return nil
+		}
+
+		d.changes[i].New = b
+		d.changes[i].Action = fileAction(d.changes[i].Action != ActionCreate, d.changes[i].Old, b)
+		d.Files[abs] = b
+		return nil
+	}
+
+	old, err := ioutil.ReadFile(abs)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "")
+	}
+	exists := err == nil
+
+	c := Change{Path: abs, Old: old, New: b}
+	if exists && !overwrite {
+		c.Action = ActionKeep
+		c.New = old
+	} else {
+		c.Action = fileAction(exists, old, b)
+		d.Files[abs] = b
+	}
+
+	d.files[abs] = len(d.changes)
+	d.changes = append(d.changes, c)
+	return nil
+}
+
+func fileAction(exists bool, old, new []byte) Action {
+	if !exists {
+		return ActionCreate
+	}
+
+	if bytes.Equal(old, new) {
+		return ActionUnchanged
+	}
+
+	return ActionOverwrite
+}
+
+func (d *DryRun) Remove(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	info, err := os.Stat(abs)
+	if os.IsNotExist(err) || d.removed[abs] {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	c := Change{Action: ActionRmdir, Path: abs}
+	if !info.IsDir() {
+		c.Action = ActionRemove
+		c.Old, err = ioutil.ReadFile(abs)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+
+	d.removed[abs] = true
+	d.changes = append(d.changes, c)
+	return nil
+}
+
+func (d *DryRun) Run(dir, name string, args ...string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.changes = append(d.changes, Change{
+		Action:  ActionRun,
+		Path:    abs,
+		Command: strings.Join(append([]string{name}, args...), " "),
+	})
+	return nil
+}
+
+// Changes returns every recorded change in the order it was made.
+func (d *DryRun) Changes() []Change {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Change(nil), d.changes...)
+}
+
+// Stale returns the changes to files whose contents on disk differ from what the generator would write, which
+// includes files that do not exist yet.
+func (d *DryRun) Stale() []Change {
+	var stale []Change
+	for _, c := range d.Changes() {
+		if c.Action == ActionCreate || c.Action == ActionOverwrite {
+			stale = append(stale, c)
+		}
+	}
+
+	return stale
+}
+
+// Report writes a summary of the changes with paths relative to root followed by a unified diff of every file
+// that would be created, overwritten or removed.
+func (d *DryRun) Report(w io.Writer, root string) error {
+	return WriteReport(w, root, d.Changes())
+}
+
+// SortChanges returns a copy of the changes ordered by path with the commands last in the order they ran, which
+// does not depend on the order the changes were made in.
+func SortChanges(changes []Change) []Change {
+	changes = append([]Change(nil), changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		if (changes[i].Action == ActionRun) != (changes[j].Action == ActionRun) {
+			return changes[j].Action == ActionRun
+		}
+		if changes[i].Action == ActionRun {
+			return false
+		}
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes
+}
+
+// WriteReport writes a summary of the changes with paths relative to root followed by a unified diff of every
+// file that is created, overwritten or removed.
+func WriteReport(w io.Writer, root string, changes []Change) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	rel := func(path string) string {
+		r, err := filepath.Rel(root, path)
+		if err != nil {
+			return path
+		}
+		return filepath.ToSlash(r)
+	}
+
+	changes = SortChanges(changes)
+
+	var b strings.Builder
+	for _, c := range changes {
+		if c.Action == ActionRun {
+			fmt.Fprintf(&b, "%-9s %s (in %s)\n", c.Action, c.Command, rel(c.Path))
+			continue
+		}
+
+		fmt.Fprintf(&b, "%-9s %s\n", c.Action, rel(c.Path))
+	}
+
+	for _, c := range changes {
+		switch c.Action {
+		case ActionCreate:
+			b.WriteString("\n" + unifiedDiff("/dev/null", "b/"+rel(c.Path), nil, c.New))
+		case ActionOverwrite:
+			b.WriteString("\n" + unifiedDiff("a/"+rel(c.Path), "b/"+rel(c.Path), c.Old, c.New))
+		case ActionRemove:
+			b.WriteString("\n" + unifiedDiff("a/"+rel(c.Path), "/dev/null", c.Old, nil))
+		}
+	}
+
+	_, err = io.WriteString(w, b.String())
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	return nil
+}
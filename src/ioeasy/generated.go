@@ -0,0 +1,104 @@
+package ioeasy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// generatedHeader marks a file as generated for go tooling and readers.
+const generatedHeader = "// Code generated by gomicro. DO NOT EDIT.\n"
+
+// hashPrefix starts the line below the header that records the hash of the rest of the file.
+const hashPrefix = "// gomicro:hash sha256:"
+
+// HandEdited returns the absolute paths of the generated files that were left untouched because they were
+// edited by hand since they were generated.
+func (o *Output) HandEdited() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]string(nil), o.handEdited...)
+}
+
+// IsGenerated returns true if the contents are of a file generated by gomicro.
+func IsGenerated(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(generatedHeader))
+}
+
+// stamp prefixes the generated file with the header and the hash of its contents.
+func stamp(b []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(generatedHeader)
+	buf.WriteString(hashPrefix + hash(b) + "\n\n")
+	buf.Write(b)
+	return buf.Bytes()
+}
+
+func hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// isHandEdited returns true if the file at path was stamped when it was generated and its contents no longer
+// match the recorded hash. Files without a hash, such as those generated by earlier versions, are not
+// protected.
+func isHandEdited(path string) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	if !bytes.HasPrefix(b, []byte(generatedHeader+hashPrefix)) {
+		return false, nil
+	}
+
+	rest := b[len(generatedHeader+hashPrefix):]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		return true, nil
+	}
+
+	recorded, body := string(rest[:i]), rest[i+1:]
+	if !bytes.HasPrefix(body, []byte("\n")) {
+		return true, nil
+	}
+
+	return hash(body[1:]) != recorded, nil
+}
+
+// mayOverwrite returns false and records the generated file at path if it was edited by hand and so may not be
+// overwritten.
+func (o *Output) mayOverwrite(path string) (bool, error) {
+	if o.force {
+		return true, nil
+	}
+
+	edited, err := isHandEdited(path)
+	if err != nil {
+		return false, err
+	}
+
+	if !edited {
+		return true, nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, errors.Wrap(err, "")
+	}
+
+	o.mu.Lock()
+	o.handEdited = append(o.handEdited, abs)
+	o.mu.Unlock()
+
+	return false, nil
+}
@@ -1,56 +1,135 @@
 package ioeasy
 
 import (
-	"io/ioutil"
-	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 
 	"gomicro/templates"
 )
 
-func CreateFileIfNotExists(path string, fc templates.FileConfig) error {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		err = ioutil.WriteFile(path, []byte{}, os.ModePerm)
-		if err != nil {
-			return errors.New("unable to create file")
-		}
+// Output is where a generation writes the output tree. Every change goes to its sink and generated files are
+// rendered with its templates, stamped and left untouched when they were edited by hand since they were generated
+// unless forced. Logicals generated in parallel share it.
+type Output struct {
+	sink      Sink
+	templates *templates.Set
+	force     bool
 
-		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
+	// mu guards the state recorded while generating
+	mu         sync.Mutex
+	handEdited []string
+	// rendered holds the file config of every generated file written keyed by absolute path
+	rendered map[string]templates.FileConfig
+}
+
+// NewOutput returns the output that sends every change to the sink and renders files with the set. Generated files
+// edited by hand are overwritten when force is true.
+func NewOutput(sink Sink, set *templates.Set, force bool) *Output {
+	return &Output{
+		sink:      sink,
+		templates: set,
+		force:     force,
+		rendered:  make(map[string]templates.FileConfig),
+	}
+}
+
+// CreateFileIfNotExists renders the file config into a new file at path. Existing files are left untouched.
+func (o *Output) CreateFileIfNotExists(path string, fc templates.FileConfig) error {
+	return o.writeFile(path, fc, false)
+}
+
+// WriteFile renders the generated file config in memory and only then replaces the file at path with it so that
+// a failure to render never leaves a partially written file. The file is stamped with the generated header and
+// the hash of its contents, and is left untouched if it was edited by hand since it was generated unless forced.
+func (o *Output) WriteFile(path string, fc templates.FileConfig) error {
+	ok, err := o.mayOverwrite(path)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	o.mu.Lock()
+	o.rendered[abs] = fc
+	o.mu.Unlock()
+
+	return o.writeFile(path, fc, true)
+}
+
+// Rendered returns the file config that the generated file at the absolute path was last written from, if any.
+func (o *Output) Rendered(path string) (templates.FileConfig, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	fc, ok := o.rendered[path]
+	return fc, ok
+}
+
+// Templates returns the set that files are rendered with.
+func (o *Output) Templates() *templates.Set {
+	return o.templates
+}
+
+func (o *Output) writeFile(path string, fc templates.FileConfig, overwrite bool) error {
+	b, err := fc.Render(o.templates)
+	if err != nil {
+		return errors.Wrap(err, "", j.KV("path", path))
+	}
 
-		for _, adder := range fc {
-			err := adder.AddTo(f)
-			if err != nil {
-				return errors.Wrap(err, "")
-			}
-		}
+	if overwrite && b != nil {
+		b = stamp(b)
 	}
 
-	return nil
+	return o.sink.WriteFile(path, b, overwrite)
 }
 
-func FileExists(path string) (bool, error) {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false, nil
-	} else if err != nil {
-		return false, err
+// Remove removes the generated file at path. Generated files edited by hand since they were generated are left
+// untouched unless forced, like with WriteFile.
+func (o *Output) Remove(path string) error {
+	ok, err := o.mayOverwrite(path)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return nil
 	}
 
-	return true, nil
+	return o.sink.Remove(path)
+}
+
+// RemoveDir removes the empty directory at path.
+func (o *Output) RemoveDir(path string) error {
+	return o.sink.Remove(path)
+}
+
+func (o *Output) FileExists(path string) (bool, error) {
+	return o.sink.Exists(path)
 }
 
-func CreateDirIfNotExists(path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := os.Mkdir(path, os.ModePerm)
-		if err != nil {
-			return errors.New("unable to create service directory")
-		}
+func (o *Output) CreateDirIfNotExists(path string) error {
+	exists, err := o.sink.Exists(path)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
 	}
 
-	return nil
-}
\ No newline at end of file
+	return o.sink.Mkdir(path)
+}
+
+// Run runs the command in dir.
+func (o *Output) Run(dir, name string, args ...string) error {
+	return o.sink.Run(dir, name, args...)
+}
@@ -0,0 +1,44 @@
+package ioeasy
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// ErrLocked is returned when another generation holds the lock of the output tree.
+var ErrLocked = errors.New("output tree is locked by another generation", errors.WithoutStackTrace())
+
+// lockName is the file that is locked while a generation changes the output tree, relative to its root.
+const lockName = ".gomicro/lock"
+
+// Lock takes the lock of the output tree at root so that only one generation changes it at a time, which keeps a
+// generation from rolling back the journal of another that is still running. It returns ErrLocked rather than
+// wait when the lock is held, and the function that releases the lock.
+func Lock(root string) (func() error, error) {
+	path := filepath.Join(root, filepath.FromSlash(lockName))
+
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		err := unlock()
+		if err != nil {
+			return err
+		}
+
+		// Remove the parent directory too unless something else lives there
+		_ = os.Remove(filepath.Dir(path))
+
+		return nil
+	}, nil
+}
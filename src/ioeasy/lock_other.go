@@ -0,0 +1,35 @@
+//go:build !unix
+
+package ioeasy
+
+import (
+	"os"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// lockFile creates the file at path exclusively. Without flock the file is left behind when the process dies,
+// in which case it is removed by hand once no generation runs.
+func lockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, newFileMode)
+	if os.IsExist(err) {
+		return nil, errors.Wrap(ErrLocked, "", j.KV("path", path))
+	} else if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	err = f.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	return func() error {
+		err := os.Remove(path)
+		if err != nil {
+			return errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		return nil
+	}, nil
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package ioeasy
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// lockFile locks the file at path with flock which the operating system releases when the process dies, so that
+// a killed generation never leaves the output tree locked. The file is removed on unlock.
+func lockFile(path string) (func() error, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, newFileMode)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == syscall.EWOULDBLOCK {
+			f.Close()
+			return nil, errors.Wrap(ErrLocked, "", j.KV("path", path))
+		} else if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		// The holder removed the file before releasing it so the lock taken is of a file nobody else will see
+		same, err := sameFile(f, path)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if !same {
+			f.Close()
+			continue
+		}
+
+		return func() error {
+			// Removed while still locked so that the next generation locks a new file
+			err := os.Remove(path)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return errors.Wrap(err, "", j.KV("path", path))
+			}
+
+			return nil
+		}, nil
+	}
+}
+
+// sameFile returns true if the open file is the one at path.
+func sameFile(f *os.File, path string) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	finfo, err := f.Stat()
+	if err != nil {
+		return false, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	return os.SameFile(info, finfo), nil
+}
@@ -0,0 +1,88 @@
+package ioeasy
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// Sink receives every change the generator makes to the output tree, being the directories and files it writes
+// or removes and the commands it runs.
+type Sink interface {
+	Exists(path string) (bool, error)
+	Mkdir(path string) error
+	// WriteFile writes the contents to the file at path. Existing files are only replaced when overwrite is true.
+	WriteFile(path string, b []byte, overwrite bool) error
+	// Remove removes the file or empty directory at path.
+	Remove(path string) error
+	// Run runs the command in dir.
+	Run(dir, name string, args ...string) error
+}
+
+// Disk applies changes directly to the file system.
+type Disk struct{}
+
+func (Disk) Exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "")
+	}
+
+	return true, nil
+}
+
+func (Disk) Mkdir(path string) error {
+	err := os.Mkdir(path, os.ModePerm)
+	if err != nil {
+		return errors.Wrap(err, "unable to create directory", j.KV("path", path))
+	}
+
+	return nil
+}
+
+func (d Disk) WriteFile(path string, b []byte, overwrite bool) error {
+	if !overwrite {
+		exists, err := d.Exists(path)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return nil
+		}
+	}
+
+	err := ioutil.WriteFile(path, b, newFileMode)
+	if err != nil {
+		return errors.Wrap(err, "unable to write file", j.KV("path", path))
+	}
+
+	return nil
+}
+
+func (Disk) Remove(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to remove", j.KV("path", path))
+	}
+
+	return nil
+}
+
+func (Disk) Run(dir, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+
+	_, err := cmd.Output()
+	if err != nil {
+		return errors.Wrap(err, "", j.MKV{"command": name + " " + strings.Join(args, " "), "dir": dir})
+	}
+
+	return nil
+}
@@ -0,0 +1,467 @@
+package ioeasy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// txnDir is where a transaction keeps its journal and the backups of the files it replaces, relative to the
+// root of the output tree.
+const txnDir = ".gomicro/txn"
+
+const journalName = "journal.json"
+
+// newFileMode is the mode of the files the generator creates.
+const newFileMode os.FileMode = 0644
+
+type entryKind string
+
+const (
+	// entryDir is a directory that the transaction created
+	entryDir entryKind = "dir"
+	// entryFile is a file that the transaction replaced, created or removed
+	entryFile entryKind = "file"
+	// entryRmdir is a directory that the transaction removed
+	entryRmdir entryKind = "rmdir"
+)
+
+// entry is a single step of a transaction in its journal. Entries for renames are journaled before they happen
+// so that rolling back tolerates steps that never took place.
+type entry struct {
+	Kind entryKind `json:"kind"`
+	Path string    `json:"path"`
+	// Backup holds the original contents of the file or is empty when the file did not exist
+	Backup string `json:"backup,omitempty"`
+}
+
+// Transaction is a Sink that stages every file the generator writes or removes in memory and only changes the
+// files in the output tree once the whole run succeeded. Directories are created and commands are run as they happen since
+// later stages depend on them, but both are journaled along with the replaced files so that a failed run is
+// rolled back to the original tree. The staged files and the changes are recorded like a dry run.
+type Transaction struct {
+	*DryRun
+
+	root string
+
+	// mu guards the journal while changes are made by logicals generated in parallel
+	mu      sync.Mutex
+	entries []entry
+	// backedUp records the files whose originals have been backed up
+	backedUp map[string]bool
+}
+
+// Begin starts a transaction on the output tree at root.
+func Begin(root string) (*Transaction, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	t := &Transaction{
+		DryRun:   NewDryRun(),
+		root:     root,
+		backedUp: make(map[string]bool),
+	}
+
+	err = os.MkdirAll(t.dir(), os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create transaction directory", j.KV("path", t.dir()))
+	}
+
+	return t, t.writeJournal()
+}
+
+func (t *Transaction) dir() string {
+	return filepath.Join(t.root, filepath.FromSlash(txnDir))
+}
+
+func (t *Transaction) Mkdir(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	err = Disk{}.Mkdir(abs)
+	if err != nil {
+		return err
+	}
+
+	// Journaled once created so that a rollback never removes a directory that already existed
+	t.mu.Lock()
+	err = t.journal(entry{Kind: entryDir, Path: abs})
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return t.DryRun.Mkdir(abs)
+}
+
+// Run runs the command in dir after backing up the module files that go commands change.
+func (t *Transaction) Run(dir, name string, args ...string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, name := range []string{"go.mod", "go.sum"} {
+		err := t.backup(filepath.Join(abs, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = Disk{}.Run(abs, name, args...)
+	if err != nil {
+		return err
+	}
+
+	return t.DryRun.Run(abs, name, args...)
+}
+
+// backup copies the file at path aside the first time it is about to be changed in place. The copy is completed
+// before it is journaled so that a rollback never restores a partial copy.
+func (t *Transaction) backup(path string) error {
+	if t.backedUp[path] {
+		return nil
+	}
+
+	e := entry{Kind: entryFile, Path: path}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "", j.KV("path", path))
+	} else if err == nil {
+		// The copy keeps the mode of the original which it is restored over
+		e.Backup = t.backupPath()
+		err = writeAtomic(e.Backup, b, fileMode(path))
+		if err != nil {
+			return err
+		}
+	}
+
+	t.backedUp[path] = true
+	return t.journal(e)
+}
+
+func (t *Transaction) backupPath() string {
+	return filepath.Join(t.dir(), fmt.Sprintf("%d.bak", len(t.entries)))
+}
+
+// Commit replaces the files of the output tree with the staged files and removes the staged removals. Every new
+// file is first written to the transaction directory and then renamed over the file it replaces, and every removed
+// file is moved to the transaction directory. Any failure rolls back the whole transaction.
+func (t *Transaction) Commit() error {
+	return t.CommitThen(nil)
+}
+
+// CommitThen commits the transaction and then calls then, if not nil, before ending it so that a failure of then
+// still rolls back the whole transaction. It is for commands that need the files in place, which then runs with
+// the transaction's Run.
+func (t *Transaction) CommitThen(then func() error) error {
+	err := t.commit()
+	if err == nil && then != nil {
+		err = then()
+	}
+
+	if err != nil {
+		rerr := t.Rollback()
+		if rerr != nil {
+			return errors.Wrap(rerr, "unable to roll back failed commit", j.KV("commit_error", err.Error()))
+		}
+
+		return err
+	}
+
+	return t.finish()
+}
+
+func (t *Transaction) commit() error {
+	// Only files that are created or whose contents change are replaced
+	staged := make(map[int]string)
+	for i, c := range t.changes {
+		if c.Action != ActionCreate && c.Action != ActionOverwrite {
+			continue
+		}
+
+		err := writeAtomic(t.stagedPath(i), c.New, fileMode(c.Path))
+		if err != nil {
+			return err
+		}
+
+		staged[i] = c.Path
+	}
+
+	for i, c := range t.changes {
+		switch c.Action {
+		case ActionRemove:
+			err := t.remove(c.Path)
+			if err != nil {
+				return err
+			}
+
+			continue
+		case ActionRmdir:
+			err := t.journal(entry{Kind: entryRmdir, Path: c.Path})
+			if err != nil {
+				return err
+			}
+
+			err = Disk{}.Remove(c.Path)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		path, ok := staged[i]
+		if !ok {
+			continue
+		}
+
+		if t.backedUp[path] {
+			err := os.Rename(t.stagedPath(i), path)
+			if err != nil {
+				return errors.Wrap(err, "unable to replace file", j.KV("path", path))
+			}
+
+			continue
+		}
+
+		e := entry{Kind: entryFile, Path: path}
+
+		exists, err := Disk{}.Exists(path)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			e.Backup = t.backupPath()
+		}
+
+		err = t.journal(e)
+		if err != nil {
+			return err
+		}
+		t.backedUp[path] = true
+
+		if exists {
+			err = os.Rename(path, e.Backup)
+			if err != nil {
+				return errors.Wrap(err, "unable to back up file", j.KV("path", path))
+			}
+		}
+
+		err = os.Rename(t.stagedPath(i), path)
+		if err != nil {
+			return errors.Wrap(err, "unable to replace file", j.KV("path", path))
+		}
+	}
+
+	return nil
+}
+
+// remove moves the file at path aside so that a rollback restores it.
+func (t *Transaction) remove(path string) error {
+	if t.backedUp[path] {
+		return Disk{}.Remove(path)
+	}
+
+	e := entry{Kind: entryFile, Path: path, Backup: t.backupPath()}
+	err := t.journal(e)
+	if err != nil {
+		return err
+	}
+	t.backedUp[path] = true
+
+	err = os.Rename(path, e.Backup)
+	if err != nil {
+		return errors.Wrap(err, "unable to remove file", j.KV("path", path))
+	}
+
+	return nil
+}
+
+func (t *Transaction) stagedPath(i int) string {
+	return filepath.Join(t.dir(), fmt.Sprintf("%d.new", i))
+}
+
+// Rollback restores the output tree to how it was before the transaction began.
+func (t *Transaction) Rollback() error {
+	err := rollback(t.entries)
+	if err != nil {
+		return err
+	}
+
+	return t.finish()
+}
+
+// finish removes the journal and the backups which ends the transaction.
+func (t *Transaction) finish() error {
+	err := os.RemoveAll(t.dir())
+	if err != nil {
+		return errors.Wrap(err, "", j.KV("path", t.dir()))
+	}
+
+	// Remove the parent directory too unless something else lives there
+	_ = os.Remove(filepath.Dir(t.dir()))
+
+	return nil
+}
+
+func (t *Transaction) journal(e entry) error {
+	t.entries = append(t.entries, e)
+	return t.writeJournal()
+}
+
+func (t *Transaction) writeJournal() error {
+	b, err := json.Marshal(t.entries)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	return writeAtomic(filepath.Join(t.dir(), journalName), b, newFileMode)
+}
+
+// Recover rolls back a transaction on the output tree at root that never finished, such as when the generator
+// was killed midway. It returns true if there was one.
+func Recover(root string) (bool, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return false, errors.Wrap(err, "")
+	}
+
+	t := &Transaction{root: root}
+	path := filepath.Join(t.dir(), journalName)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "", j.KV("path", path))
+	}
+
+	var entries []entry
+	err = json.Unmarshal(b, &entries)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid journal", j.KV("path", path))
+	}
+
+	err = rollback(entries)
+	if err != nil {
+		return false, err
+	}
+
+	return true, t.finish()
+}
+
+// rollback undoes the journaled entries in reverse order. Entries whose step never took place are skipped.
+func rollback(entries []entry) error {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		switch e.Kind {
+		case entryDir:
+			// Directories that still hold files not made by the transaction are kept
+			err := os.Remove(e.Path)
+			if err != nil && !os.IsNotExist(err) && !isNotEmpty(e.Path) {
+				return errors.Wrap(err, "unable to remove directory", j.KV("path", e.Path))
+			}
+		case entryRmdir:
+			err := os.MkdirAll(e.Path, os.ModePerm)
+			if err != nil {
+				return errors.Wrap(err, "unable to restore directory", j.KV("path", e.Path))
+			}
+		case entryFile:
+			if e.Backup == "" {
+				err := os.Remove(e.Path)
+				if err != nil && !os.IsNotExist(err) {
+					return errors.Wrap(err, "unable to remove file", j.KV("path", e.Path))
+				}
+
+				continue
+			}
+
+			exists, err := Disk{}.Exists(e.Backup)
+			if err != nil {
+				return err
+			}
+
+			// The original was never moved aside
+			if !exists {
+				continue
+			}
+
+			err = os.Rename(e.Backup, e.Path)
+			if err != nil {
+				return errors.Wrap(err, "unable to restore file", j.KV("path", e.Path))
+			}
+		}
+	}
+
+	return nil
+}
+
+func isNotEmpty(dir string) bool {
+	infos, err := ioutil.ReadDir(dir)
+	return err == nil && len(infos) > 0
+}
+
+// WriteAtomic writes the contents to a temporary file in the same directory and renames it to path so that path
+// never holds partial contents. An existing file keeps its mode and a new one is readable by all but only writable
+// by its owner.
+func WriteAtomic(path string, b []byte) error {
+	return writeAtomic(path, b, fileMode(path))
+}
+
+// writeAtomic is WriteAtomic with the mode the file is given, which is that of the file it replaces so that its
+// mode is kept.
+func writeAtomic(path string, b []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "unable to write file", j.KV("path", path))
+	}
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), mode)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.Wrap(err, "unable to write file", j.KV("path", path))
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.Wrap(err, "unable to write file", j.KV("path", path))
+	}
+
+	return nil
+}
+
+// fileMode returns the permissions of the file at path, or those of new files when there is none.
+func fileMode(path string) os.FileMode {
+	info, err := os.Stat(path)
+	if err != nil {
+		return newFileMode
+	}
+
+	return info.Mode().Perm()
+}
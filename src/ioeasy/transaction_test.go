@@ -0,0 +1,226 @@
+package ioeasy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tree writes the files, keyed by path relative to root, with their modes.
+func tree(t *testing.T, root string, files map[string]string, modes map[string]os.FileMode) {
+	t.Helper()
+
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mode, ok := modes[name]
+		if !ok {
+			mode = newFileMode
+		}
+
+		err = ioutil.WriteFile(path, []byte(contents), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chmod(path, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// assertFile fails unless the file at path holds contents with the mode.
+func assertFile(t *testing.T, path, contents string, mode os.FileMode) {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != contents {
+		t.Errorf("%s holds %q, want %q", path, b, contents)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != mode {
+		t.Errorf("%s has mode %v, want %v", path, info.Mode().Perm(), mode)
+	}
+}
+
+func assertNotExist(t *testing.T, path string) {
+	t.Helper()
+
+	_, err := os.Stat(path)
+	if !os.IsNotExist(err) {
+		t.Errorf("%s exists, want it removed", path)
+	}
+}
+
+// stage begins a transaction on root that overwrites a.go, creates b/c.go and removes d.go.
+func stage(t *testing.T, root string) *Transaction {
+	t.Helper()
+
+	tx, err := Begin(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.WriteFile(filepath.Join(root, "a.go"), []byte("new a"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.Mkdir(filepath.Join(root, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.WriteFile(filepath.Join(root, "b", "c.go"), []byte("new c"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.Remove(filepath.Join(root, "d.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+func TestTransactionCommit(t *testing.T) {
+	root := t.TempDir()
+	tree(t, root, map[string]string{"a.go": "old a", "d.go": "old d"}, map[string]os.FileMode{"a.go": 0600})
+
+	tx := stage(t, root)
+
+	// Nothing but the directories changes until the transaction commits
+	assertFile(t, filepath.Join(root, "a.go"), "old a", 0600)
+	assertFile(t, filepath.Join(root, "d.go"), "old d", newFileMode)
+	assertNotExist(t, filepath.Join(root, "b", "c.go"))
+
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFile(t, filepath.Join(root, "a.go"), "new a", 0600)
+	assertFile(t, filepath.Join(root, "b", "c.go"), "new c", newFileMode)
+	assertNotExist(t, filepath.Join(root, "d.go"))
+	assertNotExist(t, filepath.Join(root, ".gomicro"))
+}
+
+func TestTransactionRollback(t *testing.T) {
+	root := t.TempDir()
+	tree(t, root, map[string]string{"a.go": "old a", "d.go": "old d"}, map[string]os.FileMode{"a.go": 0600})
+
+	tx := stage(t, root)
+
+	err := tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFile(t, filepath.Join(root, "a.go"), "old a", 0600)
+	assertFile(t, filepath.Join(root, "d.go"), "old d", newFileMode)
+	assertNotExist(t, filepath.Join(root, "b"))
+	assertNotExist(t, filepath.Join(root, ".gomicro"))
+}
+
+func TestTransactionCommitThenFails(t *testing.T) {
+	root := t.TempDir()
+	tree(t, root, map[string]string{"a.go": "old a", "d.go": "old d"}, map[string]os.FileMode{"a.go": 0600})
+
+	tx := stage(t, root)
+
+	failed := os.ErrInvalid
+	err := tx.CommitThen(func() error {
+		// The files are in place when then runs
+		assertFile(t, filepath.Join(root, "a.go"), "new a", 0600)
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("got error %v, want %v", err, failed)
+	}
+
+	assertFile(t, filepath.Join(root, "a.go"), "old a", 0600)
+	assertFile(t, filepath.Join(root, "d.go"), "old d", newFileMode)
+	assertNotExist(t, filepath.Join(root, "b"))
+	assertNotExist(t, filepath.Join(root, ".gomicro"))
+}
+
+func TestRecover(t *testing.T) {
+	root := t.TempDir()
+	tree(t, root, map[string]string{"a.go": "old a", "d.go": "old d"}, map[string]os.FileMode{"a.go": 0600})
+
+	tx := stage(t, root)
+
+	// The generator dies once the files are in place but before the transaction ends, leaving its journal
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+
+		_ = tx.CommitThen(func() error {
+			panic("killed")
+		})
+	}()
+
+	assertFile(t, filepath.Join(root, "a.go"), "new a", 0600)
+
+	ok, err := Recover(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("no transaction recovered")
+	}
+
+	assertFile(t, filepath.Join(root, "a.go"), "old a", 0600)
+	assertFile(t, filepath.Join(root, "d.go"), "old d", newFileMode)
+	assertNotExist(t, filepath.Join(root, "b"))
+	assertNotExist(t, filepath.Join(root, ".gomicro"))
+
+	ok, err = Recover(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok {
+		t.Error("recovered a transaction that already ended")
+	}
+}
+
+func TestRecoverBeforeCommit(t *testing.T) {
+	root := t.TempDir()
+	tree(t, root, map[string]string{"a.go": "old a", "d.go": "old d"}, nil)
+
+	// The generator dies while staging so only the created directory is in the tree
+	stage(t, root)
+
+	ok, err := Recover(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("no transaction recovered")
+	}
+
+	assertFile(t, filepath.Join(root, "a.go"), "old a", newFileMode)
+	assertFile(t, filepath.Join(root, "d.go"), "old d", newFileMode)
+	assertNotExist(t, filepath.Join(root, "b"))
+	assertNotExist(t, filepath.Join(root, ".gomicro"))
+}
@@ -0,0 +1,275 @@
+package lint
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"gomicro/reader"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rule IDs reported by the linter. Each rule enforces one of the API rules that the generated transports
+// depend on.
+const (
+	// RuleContextFirst requires every method to take a context.Context as its first parameter
+	RuleContextFirst = "GM001"
+	// RuleErrorLast requires every method to return an error as its last result
+	RuleErrorLast = "GM002"
+	// RuleNamedParams recommends naming every parameter since unnamed parameters are sent in request fields
+	// named after their types
+	RuleNamedParams = "GM003"
+	// RuleExportedFields requires the fields of structs sent over the wire to be exported
+	RuleExportedFields = "GM004"
+	// RuleExportedMethod requires every method to be exported so that clients in other packages implement it
+	RuleExportedMethod = "GM005"
+	// RuleFieldType requires the fields of structs sent over the wire to have types that can be encoded
+	RuleFieldType = "GM006"
+	// RuleJSONTag requires the exported fields of structs sent over the wire to have a json tag
+	RuleJSONTag = "GM007"
+)
+
+// Diagnostic is a single violation of an API rule.
+type Diagnostic struct {
+	Pos      token.Position
+	Rule     string
+	Severity Severity
+	Message  string
+	// Fix is a suggestion for resolving the violation
+	Fix string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s %s: %s (fix: %s)", d.Pos, d.Severity, d.Rule, d.Message, d.Fix)
+}
+
+// ErrViolations is returned when an API violates rules that would result in generated code that does not compile.
+var ErrViolations = errors.New("api violates gomicro rules", errors.WithoutStackTrace())
+
+// Error returns ErrViolations listing every error diagnostic or nil if there are none.
+func Error(ds []Diagnostic) error {
+	var violations []string
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			violations = append(violations, d.String())
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return errors.Wrap(ErrViolations, "", j.KV("diagnostics", strings.Join(violations, "; ")))
+}
+
+// HasErrors returns true if any of the diagnostics is an error.
+func HasErrors(ds []Diagnostic) bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check validates the methods of every interface and the types they send over the wire against the API rules
+// and returns every violation ordered by position.
+func Check(api *reader.API) []Diagnostic {
+	var ds []Diagnostic
+	for _, it := range api.Interfaces {
+		for _, method := range it.Methods {
+			ds = append(ds, checkMethod(it, method)...)
+		}
+	}
+
+	for _, td := range api.Types {
+		ds = append(ds, checkType(td)...)
+	}
+
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i].Pos, ds[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return ds
+}
+
+var qualifiedIdent = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.`)
+
+func checkMethod(api reader.Interface, method reader.FunctionSignature) []Diagnostic {
+	var ds []Diagnostic
+
+	if !token.IsExported(method.Name) {
+		ds = append(ds, Diagnostic{
+			Pos:      method.Pos,
+			Rule:     RuleExportedMethod,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("method %s.%s is not exported", api.Name, method.Name),
+			Fix:      fmt.Sprintf("rename the method to %s", strings.ToUpper(method.Name[:1])+method.Name[1:]),
+		})
+	}
+
+	if len(method.Params) == 0 || !reader.IsContext(method.Params[0].Type) {
+		pos := method.Pos
+		if len(method.Params) > 0 {
+			pos = method.Params[0].Pos
+		}
+
+		ds = append(ds, Diagnostic{
+			Pos:      pos,
+			Rule:     RuleContextFirst,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("method %s.%s must take a context.Context as its first parameter", api.Name, method.Name),
+			Fix:      "add ctx context.Context as the first parameter",
+		})
+	}
+
+	if len(method.Results) == 0 || !isError(method.Results[len(method.Results)-1].Type) {
+		pos := method.Pos
+		if len(method.Results) > 0 {
+			pos = method.Results[len(method.Results)-1].Pos
+		}
+
+		ds = append(ds, Diagnostic{
+			Pos:      pos,
+			Rule:     RuleErrorLast,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("method %s.%s must return an error as its last result", api.Name, method.Name),
+			Fix:      "add error as the last result",
+		})
+	}
+
+	for i, p := range method.Params {
+		if p.Name != "" {
+			continue
+		}
+
+		ds = append(ds, Diagnostic{
+			Pos:      p.Pos,
+			Rule:     RuleNamedParams,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("parameter %d of method %s.%s has no name so its request field is named after its type", i, api.Name, method.Name),
+			Fix:      fmt.Sprintf("name the parameter, e.g. %s %s", suggestName(p.Type, qualifiers(method)), p.ImportType),
+		})
+	}
+
+	return ds
+}
+
+// checkType validates that the fields of a struct sent over the wire are all encoded as expected.
+func checkType(td reader.TypeDecl) []Diagnostic {
+	if td.Marshaler {
+		return nil
+	}
+
+	var ds []Diagnostic
+	for _, f := range td.Fields {
+		if f.JSONName == "-" {
+			continue
+		}
+
+		if !f.Exported && !f.Embedded {
+			ds = append(ds, Diagnostic{
+				Pos:      f.Pos,
+				Rule:     RuleExportedFields,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("field %s of %s is unexported and will not be sent over the wire", f.Name, td.Name),
+				Fix:      fmt.Sprintf("export the field as %s", strings.ToUpper(f.Name[:1])+f.Name[1:]),
+			})
+			continue
+		}
+
+		if err := reader.CheckWireType(f.Type); err != nil || isInterface(f.Type) {
+			ds = append(ds, Diagnostic{
+				Pos:      f.Pos,
+				Rule:     RuleFieldType,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("field %s of %s has type %s which cannot be sent over the wire", f.Name, td.Name, f.ImportType),
+				Fix:      `change the type of the field or exclude it with a json:"-" tag`,
+			})
+			continue
+		}
+
+		if !f.HasJSON && !f.Embedded {
+			ds = append(ds, Diagnostic{
+				Pos:      f.Pos,
+				Rule:     RuleJSONTag,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("field %s of %s has no json tag", f.Name, td.Name),
+				Fix:      fmt.Sprintf("add the tag `json:\"%s\"`", reader.LowerInitialism(f.Name)),
+			})
+		}
+	}
+
+	return ds
+}
+
+// isInterface returns true for interfaces with methods which cannot be decoded from the wire.
+func isInterface(typ types.Type) bool {
+	it, ok := typ.Underlying().(*types.Interface)
+	return ok && it.NumMethods() > 0
+}
+
+func isError(typ types.Type) bool {
+	return types.Identical(typ, types.Universe.Lookup("error").Type())
+}
+
+// suggestName returns a parameter name derived from the name of the type. Contexts are named ctx and names that
+// are taken, such as the package qualifiers of the method's types, are avoided.
+func suggestName(typ types.Type, taken map[string]bool) string {
+	if reader.IsContext(typ) {
+		return "ctx"
+	}
+
+	name := "v"
+	switch t := types.Unalias(typ).(type) {
+	case *types.Pointer:
+		return suggestName(t.Elem(), taken)
+	case *types.Named:
+		name = reader.LowerInitialism(t.Obj().Name())
+	}
+
+	// time.Time is suggested as t rather than time which shadows the package
+	if taken[name] || token.Lookup(name).IsKeyword() {
+		name = name[:1]
+	}
+
+	if taken[name] {
+		name = "v"
+	}
+
+	return name
+}
+
+// qualifiers returns the package qualifiers of the types of the method's parameters and results.
+func qualifiers(method reader.FunctionSignature) map[string]bool {
+	taken := make(map[string]bool)
+	for _, vs := range [][]reader.Variable{method.Params, method.Results} {
+		for _, v := range vs {
+			for _, m := range qualifiedIdent.FindAllStringSubmatch(v.ImportType, -1) {
+				taken[m[1]] = true
+			}
+		}
+	}
+
+	return taken
+}
@@ -0,0 +1,124 @@
+package lint
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gomicro/reader"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		types  string
+		rules  []string
+		fixes  []string
+	}{
+		{
+			name:   "valid",
+			method: "Get(ctx context.Context, id string) (User, error)",
+			types:  "type User struct {\n\tName string `json:\"name\"`\n}",
+		},
+		{
+			name:   "no context",
+			method: "Get(id string) error",
+			rules:  []string{RuleContextFirst},
+		},
+		{
+			name:   "context not first",
+			method: "Get(id string, ctx context.Context) error",
+			rules:  []string{RuleContextFirst},
+		},
+		{
+			name:   "no error",
+			method: "Get(ctx context.Context) string",
+			rules:  []string{RuleErrorLast},
+		},
+		{
+			name:   "no results",
+			method: "Get(ctx context.Context)",
+			rules:  []string{RuleErrorLast},
+		},
+		{
+			name:   "unexported method",
+			method: "get(ctx context.Context) error",
+			rules:  []string{RuleExportedMethod},
+			fixes:  []string{"rename the method to Get"},
+		},
+		{
+			name:   "unnamed params",
+			method: "Get(context.Context, time.Time, *User) error",
+			types:  "type User struct{}",
+			rules:  []string{RuleNamedParams, RuleNamedParams, RuleNamedParams},
+			fixes: []string{
+				"name the parameter, e.g. ctx context.Context",
+				"name the parameter, e.g. t time.Time",
+				"name the parameter, e.g. user *users.User",
+			},
+		},
+		{
+			name:   "unexported field",
+			method: "Get(ctx context.Context) (User, error)",
+			types:  "type User struct {\n\tname string\n}",
+			rules:  []string{RuleExportedFields},
+			fixes:  []string{"export the field as Name"},
+		},
+		{
+			name:   "field type",
+			method: "Get(ctx context.Context) (User, error)",
+			types:  "type User struct {\n\tDone chan bool `json:\"done\"`\n}",
+			rules:  []string{RuleFieldType},
+		},
+		{
+			name:   "excluded field",
+			method: "Get(ctx context.Context) (User, error)",
+			types:  "type User struct {\n\tDone chan bool `json:\"-\"`\n}",
+		},
+		{
+			name:   "json tag",
+			method: "Get(ctx context.Context) (User, error)",
+			types:  "type User struct {\n\tUserID string\n\tURL string\n}",
+			rules:  []string{RuleJSONTag, RuleJSONTag},
+			fixes:  []string{"add the tag `json:\"userID\"`", "add the tag `json:\"url\"`"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := "package users\n\nimport (\n\t\"context\"\n\t\"time\"\n)\n\nvar _ context.Context\nvar _ time.Time\n\n" +
+				"type API interface {\n\t" + test.method + "\n}\n\n" + test.types + "\n"
+
+			for name, b := range map[string]string{"go.mod": "module example\n\ngo 1.23\n", "api.go": src} {
+				err := ioutil.WriteFile(filepath.Join(dir, name), []byte(b), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			api, err := reader.NewLoader().ReadAPI("users", filepath.Join(dir, "api.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rules, fixes []string
+			for _, d := range Check(api) {
+				rules = append(rules, d.Rule)
+				if test.fixes != nil {
+					fixes = append(fixes, d.Fix)
+				}
+			}
+
+			if !reflect.DeepEqual(rules, test.rules) {
+				t.Errorf("rules %v, want %v", rules, test.rules)
+			}
+
+			if !reflect.DeepEqual(fixes, test.fixes) {
+				t.Errorf("fixes %q, want %q", fixes, test.fixes)
+			}
+		})
+	}
+}
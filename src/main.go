@@ -3,17 +3,36 @@ package main
 import (
 	"context"
 	"flag"
-	"github.com/luno/jettison/errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/log"
 
 	"gomicro/config"
+	"gomicro/generate"
+	"gomicro/ioeasy"
+	"gomicro/lint"
+	"gomicro/reader"
+	"gomicro/templates"
 	"gomicro/wireup"
 )
 
 var configPath = flag.String("config", "../example/config.yaml", "The location of the GoMicro config yaml file")
 var outputPath = flag.String("output", "../myRepo", "The directory to generate the services or update them")
+var dryRun = flag.Bool("dry-run", false, "Print the changes generation would make as a unified diff without making them")
+var force = flag.Bool("force", false, "Overwrite generated files even when they were edited by hand")
+var full = flag.Bool("full", false, "Regenerate every logical rather than only those that changed since the last generation")
+var prune = flag.Bool("prune", false, "Remove generated files that are no longer generated from the config, such as those of removed logicals")
+var verify = flag.Bool("verify", false, "Type check the packages that hold generated code once generated and print every error, exits non-zero on errors")
+var deleteOwned = flag.Bool("delete-owned", false, "Also delete the files written by hand, such as the API, of logicals that are removed")
+var parallel = flag.Int("parallel", 0, "The number of logicals to generate at once, the number of CPUs by default")
+var stages = flag.String("stages", "", "Comma separated stages to run in order, all of them by default: framework, http, dependencies, runtime, plugins")
+
+// The commands are listed by usage in commands.go.
 
 // main scenario 1:
 // Nothing exists and a boilerplate must be built
@@ -45,57 +64,146 @@ var outputPath = flag.String("output", "../myRepo", "The directory to generate t
 // Comments will be written in the implementation file from the interface
 
 func main() {
+	flag.Usage = printUsage
 	flag.Parse()
 
 	ctx := context.Background()
 
-	// get the current location that its being executed from
-	wd, err := os.Getwd()
-	if err != nil {
+	ok, err := command(ctx, flag.Args())
+	if errors.Is(err, errUsage) {
+		flag.Usage()
+		os.Exit(2)
+	} else if err != nil {
 		log.Error(ctx, err)
-		panic(err)
+		os.Exit(1)
 	}
 
-	// change directory to its being executed from
-	err = os.Chdir(wd)
-	if err != nil {
-		log.Error(ctx, err)
-		panic(err)
+	if !ok {
+		os.Exit(1)
 	}
+}
 
-	c, err := config.ParseConfig(*configPath)
-	if err != nil {
-		log.Error(ctx, err)
-		panic(err)
+// templatesDir returns the template override directory of the config relative to the config file.
+func templatesDir(c *config.Config) string {
+	if c.Templates == "" || filepath.IsAbs(c.Templates) {
+		return c.Templates
 	}
 
-	err = os.Chdir(*outputPath)
-	if err != nil {
-		log.Error(ctx, err)
-		panic(err)
+	return filepath.Join(filepath.Dir(*configPath), c.Templates)
+}
+
+// printHandEdited prints every generated file that was left untouched since it was edited by hand.
+func printHandEdited(r generate.Report) {
+	for _, path := range r.HandEdited {
+		fmt.Printf("%s: edited by hand, revert the edits or rerun with -force to overwrite them\n", relPath(r.Root, path))
 	}
+}
 
-	err = wireup.FrameworkWithFillInStrategy(c)
-	if err != nil {
-		log.Error(ctx, err)
-		panic(err)
+// printOwned prints every file written by hand that keeps a removed logical from being removed.
+func printOwned(r generate.Report) {
+	for _, path := range r.Owned {
+		fmt.Printf("%s: written by hand, move or delete it, or rerun with -delete-owned to delete it\n", relPath(r.Root, path))
 	}
+}
 
-	err = wireup.HttpClientServer(c)
+func relPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
 	if err != nil {
-		log.Error(ctx, err)
-		panic(err)
+		return path
 	}
 
-	err = wireup.Dependencies(c)
+	return filepath.ToSlash(rel)
+}
+
+// exportTemplates writes every built-in template to dir named after the template so that they can be edited and
+// used as overrides. Existing files are left untouched.
+func exportTemplates(dir string) error {
+	err := os.MkdirAll(dir, os.ModePerm)
 	if err != nil {
-		log.Error(ctx, err)
-		panic(err)
+		return errors.Wrap(err, "", j.KV("dir", dir))
 	}
 
-	err = wireup.LogicalRuntimeSetup(c)
-	if err != nil {
-		log.Error(ctx, err)
-		panic(err)
+	defaults := templates.Defaults()
+	for _, name := range templates.Names() {
+		path := filepath.Join(dir, name+templates.OverrideExt)
+
+		_, err := os.Stat(path)
+		if err == nil {
+			fmt.Printf("%s: exists, kept\n", path)
+			continue
+		} else if !os.IsNotExist(err) {
+			return errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		err = ioutil.WriteFile(path, []byte(defaults[name]), 0644)
+		if err != nil {
+			return errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		fmt.Println(path)
+	}
+
+	return nil
+}
+
+// lintAPIs checks the API of every logical against the API rules and prints each violation. It returns false
+// if any violation is an error.
+func lintAPIs(c *config.Config, root string) (bool, error) {
+	ok := true
+	l := reader.NewLoader()
+	for _, logical := range c.Service.Logicals {
+		if logical.API.FileName == "" {
+			continue
+		}
+
+		names, err := wireup.APIInterfaces(logical)
+		if err != nil {
+			return false, err
+		}
+
+		path := filepath.Join(root, c.Service.Name, logical.Name, logical.API.FileName)
+		api, err := l.ReadAPI(logical.Name, path, names...)
+		if err != nil {
+			return false, err
+		}
+
+		ds := lint.Check(api)
+		for _, d := range ds {
+			fmt.Println(d)
+		}
+
+		if lint.HasErrors(ds) {
+			ok = false
+		}
+	}
+
+	return ok, nil
+}
+
+// checkGenerated regenerates the transports, dependencies and runtime setup of every logical in memory and prints
+// each generated file that differs from the one on disk. It returns false if any file is stale.
+func checkGenerated(ctx context.Context, c *config.Config, o generate.Options) (bool, error) {
+	// The framework stage is left out since it only creates the files that are meant to be edited
+	o.Stages = generate.GeneratedStages
+	o.DryRun = true
+	o.Log = nil
+
+	r, err := generate.Generate(ctx, c, o)
+	if err != nil && !errors.Is(err, generate.ErrHandEdited) {
+		return false, err
 	}
+
+	stale := r.Stale()
+	for _, change := range stale {
+		if change.Action == ioeasy.ActionCreate {
+			fmt.Printf("%s: stale, missing\n", relPath(r.Root, change.Path))
+			continue
+		}
+
+		fmt.Printf("%s: stale, regenerate to update\n", relPath(r.Root, change.Path))
+	}
+
+	printHandEdited(r)
+
+	return len(stale) == 0 && len(r.HandEdited) == 0, nil
 }
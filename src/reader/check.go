@@ -0,0 +1,108 @@
+package reader
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// CheckPackages type checks the packages in dirs including the bodies of their functions, like the compiler
+// would, and returns every type error in them. Imported packages are type checked from source like with
+// LoadPackage, once for all the packages, and files of the overlay take precedence over the disk so that
+// generated code is checked before it is written. The packages are expected to belong to the same module.
+func (l *Loader) CheckPackages(dirs ...string) ([]types.Error, error) {
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+
+	fset := l.fset
+	imp := newSourceImporter(l, dirs[0])
+
+	var typeErrs []types.Error
+	for _, dir := range dirs {
+		errs, err := l.checkPackage(fset, imp, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		typeErrs = append(typeErrs, errs...)
+	}
+
+	return typeErrs, nil
+}
+
+func (l *Loader) checkPackage(fset *token.FileSet, imp *sourceImporter, dir string) ([]types.Error, error) {
+	ctxt := l.overlayContext(build.Default)
+	bp, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("dir", dir))
+	}
+
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		path := filepath.Join(dir, name)
+		f, err := parser.ParseFile(fset, path, l.overlaySource(path), 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		files = append(files, f)
+	}
+
+	var typeErrs []types.Error
+	conf := types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			if te, ok := err.(types.Error); ok {
+				typeErrs = append(typeErrs, te)
+			}
+		},
+	}
+
+	path := importPath(dir, bp.ImportPath)
+
+	// Imports of the package that lead back to it are reported as import cycles rather than the errors of the
+	// incomplete packages they result in. The package is type checked again when imported by the others since
+	// only its declarations matter to them.
+	prev, imported := imp.packages[path]
+	imp.packages[path] = nil
+	imp.paths[filepath.Clean(dir)] = path
+
+	_, _ = conf.Check(path, fset, files, nil)
+
+	if imported {
+		imp.packages[path] = prev
+	} else {
+		delete(imp.packages, path)
+	}
+
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			imported, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || imported == path {
+				continue
+			}
+
+			chain := imp.cycle(imported, path)
+			if chain == nil {
+				continue
+			}
+
+			typeErrs = append(typeErrs, types.Error{
+				Fset: fset,
+				Pos:  spec.Pos(),
+				Msg:  "import cycle not allowed: " + strings.Join(append([]string{path}, chain...), " imports "),
+			})
+		}
+	}
+
+	return typeErrs, nil
+}
@@ -0,0 +1,236 @@
+package reader
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// ErrInvalidDirective is returned when a gomicro directive in the doc comment of an API method is malformed or
+// does not match the method's signature.
+var ErrInvalidDirective = errors.New("invalid gomicro directive", errors.WithoutStackTrace())
+
+const (
+	directivePrefix = "//gomicro:"
+	httpDirective   = directivePrefix + "http"
+)
+
+// bodyVerbs are the http methods whose requests carry the method's parameters as a json body
+var bodyVerbs = map[string]bool{
+	http.MethodPost:  true,
+	http.MethodPut:   true,
+	http.MethodPatch: true,
+}
+
+var verbs = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+var pathParam = regexp.MustCompile(`^\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// HTTPRoute is how a method is served over http as set by a directive in its doc comment, for example
+//
+//	//gomicro:http GET /users/{id} query=limit,offset status=200
+//
+// Path parameters and query parameters bind to the method parameters of the same name.
+type HTTPRoute struct {
+	Verb string
+	// Path is the path template with path parameters as whole segments in braces
+	Path string
+
+	PathParams  []string
+	QueryParams []string
+
+	// Status is the status code of successful responses
+	Status int
+
+	Pos token.Position
+}
+
+// HasBody returns true if the parameters of the method are sent as a json body.
+func (r HTTPRoute) HasBody() bool {
+	return bodyVerbs[r.Verb]
+}
+
+// parseDirectives returns the http route set by the gomicro directives in the doc comment of a method or nil
+// when there is none.
+func (r *Reader) parseDirectives(sig FunctionSignature, doc *ast.CommentGroup) (*HTTPRoute, error) {
+	if doc == nil {
+		return nil, nil
+	}
+
+	var route *HTTPRoute
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, directivePrefix) {
+			continue
+		}
+
+		kv := j.MKV{
+			"method":    sig.Name,
+			"directive": c.Text,
+			"position":  r.Fset.Position(c.Pos()).String(),
+		}
+
+		fields := strings.Fields(c.Text)
+		if fields[0] != httpDirective {
+			return nil, errors.Wrap(ErrInvalidDirective, "unknown directive", kv)
+		}
+
+		if route != nil {
+			return nil, errors.Wrap(ErrInvalidDirective, "more than one http directive", kv)
+		}
+
+		rt, err := parseHTTPRoute(sig, fields[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "", kv)
+		}
+
+		rt.Pos = r.Fset.Position(c.Pos())
+		route = &rt
+	}
+
+	return route, nil
+}
+
+// parseHTTPRoute parses the arguments of an http directive, being the verb, the path template and optional
+// query and status options, and validates them against the method's parameters.
+func parseHTTPRoute(sig FunctionSignature, args []string) (HTTPRoute, error) {
+	if len(args) < 2 {
+		return HTTPRoute{}, errors.Wrap(ErrInvalidDirective, "expected a verb and a path")
+	}
+
+	route := HTTPRoute{
+		Verb:   args[0],
+		Path:   args[1],
+		Status: http.StatusOK,
+	}
+
+	if !verbs[route.Verb] {
+		return HTTPRoute{}, errors.Wrap(ErrInvalidDirective, "unsupported verb", j.KV("verb", route.Verb))
+	}
+
+	if !strings.HasPrefix(route.Path, "/") || strings.ContainsAny(route.Path, "?#") {
+		return HTTPRoute{}, errors.Wrap(ErrInvalidDirective, "path must be absolute without a query", j.KV("path", route.Path))
+	}
+
+	for _, segment := range strings.Split(route.Path, "/") {
+		if m := pathParam.FindStringSubmatch(segment); m != nil {
+			route.PathParams = append(route.PathParams, m[1])
+		} else if strings.ContainsAny(segment, "{}") {
+			return HTTPRoute{}, errors.Wrap(ErrInvalidDirective, "path parameters must be whole segments", j.KV("segment", segment))
+		}
+	}
+
+	for _, opt := range args[2:] {
+		parts := strings.SplitN(opt, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return HTTPRoute{}, errors.Wrap(ErrInvalidDirective, "expected an option of the form key=value", j.KV("option", opt))
+		}
+
+		switch parts[0] {
+		case "query":
+			route.QueryParams = append(route.QueryParams, strings.Split(parts[1], ",")...)
+		case "status":
+			status, err := strconv.Atoi(parts[1])
+			if err != nil || status < 200 || status > 299 {
+				return HTTPRoute{}, errors.Wrap(ErrInvalidDirective, "status must be a 2xx code", j.KV("status", parts[1]))
+			}
+			route.Status = status
+		default:
+			return HTTPRoute{}, errors.Wrap(ErrInvalidDirective, "unknown option", j.KV("option", opt))
+		}
+	}
+
+	// No content responses cannot carry the method's results
+	if route.Status == http.StatusNoContent && len(sig.Results) > 1 {
+		return HTTPRoute{}, errors.Wrap(ErrInvalidDirective, "status 204 is only supported by methods returning just an error")
+	}
+
+	err := checkBindings(sig, route)
+	if err != nil {
+		return HTTPRoute{}, err
+	}
+
+	return route, nil
+}
+
+// checkBindings ensures that every path and query parameter binds to exactly one method parameter that can be
+// parsed from text and that methods without a body have all their parameters bound.
+func checkBindings(sig FunctionSignature, route HTTPRoute) error {
+	params := make(map[string]Variable)
+	for i, v := range sig.Params {
+		// The context is taken from the request rather than bound
+		if v.Name != "" && v.Name != "_" && !(i == 0 && IsContext(v.Type)) {
+			params[v.Name] = v
+		}
+	}
+
+	bound := make(map[string]bool)
+	for _, name := range append(append([]string(nil), route.PathParams...), route.QueryParams...) {
+		v, ok := params[name]
+		if !ok {
+			return errors.Wrap(ErrInvalidDirective, "no method parameter to bind to", j.KV("param", name))
+		}
+
+		if bound[name] {
+			return errors.Wrap(ErrInvalidDirective, "parameter is bound more than once", j.KV("param", name))
+		}
+		bound[name] = true
+
+		if strings.HasPrefix(v.ImportType, "...") || !isTextType(v.Type) {
+			return errors.Wrap(ErrInvalidDirective, "bound parameters must be strings, booleans or numbers", j.MKV{
+				"param": name,
+				"type":  v.ImportType,
+			})
+		}
+	}
+
+	if route.HasBody() {
+		return nil
+	}
+
+	for i, v := range sig.Params {
+		if i == 0 && IsContext(v.Type) {
+			continue
+		}
+
+		// Unnamed parameters have nothing to bind to so a request without a body would never carry them
+		if v.Name == "" || v.Name == "_" {
+			return errors.Wrap(ErrInvalidDirective, "parameters of requests without a body must be named", j.MKV{
+				"index": i,
+				"verb":  route.Verb,
+			})
+		}
+
+		if !bound[v.Name] {
+			return errors.Wrap(ErrInvalidDirective, "parameters of requests without a body must be bound to the path or query", j.MKV{
+				"param": v.Name,
+				"verb":  route.Verb,
+			})
+		}
+	}
+
+	return nil
+}
+
+// isTextType returns true for types that are parsed from path and query parameters, being strings, booleans and
+// real numbers or named types declared as one.
+func isTextType(typ types.Type) bool {
+	b, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return false
+	}
+
+	return b.Info()&(types.IsString|types.IsBoolean|types.IsInteger|types.IsFloat) != 0
+}
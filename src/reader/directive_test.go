@@ -0,0 +1,203 @@
+package reader
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/luno/jettison/errors"
+)
+
+func TestHTTPDirectives(t *testing.T) {
+	tests := []struct {
+		name      string
+		directive string
+		method    string
+		want      *HTTPRoute
+		err       bool
+	}{
+		{
+			name:   "none",
+			method: "Get(ctx context.Context, id string) error",
+		},
+		{
+			name:      "path and query",
+			directive: "//gomicro:http GET /users/{id} query=limit,offset",
+			method:    "Get(ctx context.Context, id string, limit int, offset int) error",
+			want: &HTTPRoute{
+				Verb:        "GET",
+				Path:        "/users/{id}",
+				PathParams:  []string{"id"},
+				QueryParams: []string{"limit", "offset"},
+				Status:      200,
+			},
+		},
+		{
+			name:      "body with status",
+			directive: "//gomicro:http PUT /users/{id} status=202",
+			method:    "Put(ctx context.Context, id string, u User) error",
+			want: &HTTPRoute{
+				Verb:       "PUT",
+				Path:       "/users/{id}",
+				PathParams: []string{"id"},
+				Status:     202,
+			},
+		},
+		{
+			name:      "context under another name",
+			directive: "//gomicro:http DELETE /users/{id} status=204",
+			method:    "Delete(c gocontext.Context, id ID) error",
+			want: &HTTPRoute{
+				Verb:       "DELETE",
+				Path:       "/users/{id}",
+				PathParams: []string{"id"},
+				Status:     204,
+			},
+		},
+		{
+			name:      "unknown directive",
+			directive: "//gomicro:grpc Get",
+			method:    "Get(ctx context.Context) error",
+			err:       true,
+		},
+		{
+			name:      "missing path",
+			directive: "//gomicro:http GET",
+			method:    "Get(ctx context.Context) error",
+			err:       true,
+		},
+		{
+			name:      "unsupported verb",
+			directive: "//gomicro:http HEAD /users",
+			method:    "Get(ctx context.Context) error",
+			err:       true,
+		},
+		{
+			name:      "relative path",
+			directive: "//gomicro:http GET users",
+			method:    "Get(ctx context.Context) error",
+			err:       true,
+		},
+		{
+			name:      "query in path",
+			directive: "//gomicro:http GET /users?id=1",
+			method:    "Get(ctx context.Context) error",
+			err:       true,
+		},
+		{
+			name:      "partial segment",
+			directive: "//gomicro:http GET /users/id-{id}",
+			method:    "Get(ctx context.Context, id string) error",
+			err:       true,
+		},
+		{
+			name:      "unknown option",
+			directive: "//gomicro:http GET /users cache=1",
+			method:    "Get(ctx context.Context) error",
+			err:       true,
+		},
+		{
+			name:      "status not 2xx",
+			directive: "//gomicro:http GET /users status=404",
+			method:    "Get(ctx context.Context) error",
+			err:       true,
+		},
+		{
+			name:      "no content with results",
+			directive: "//gomicro:http GET /users/{id} status=204",
+			method:    "Get(ctx context.Context, id string) (User, error)",
+			err:       true,
+		},
+		{
+			name:      "unknown param",
+			directive: "//gomicro:http GET /users/{name}",
+			method:    "Get(ctx context.Context, id string) error",
+			err:       true,
+		},
+		{
+			name:      "bound twice",
+			directive: "//gomicro:http GET /users/{id} query=id",
+			method:    "Get(ctx context.Context, id string) error",
+			err:       true,
+		},
+		{
+			name:      "bound struct",
+			directive: "//gomicro:http POST /users/{u}",
+			method:    "Post(ctx context.Context, u User) error",
+			err:       true,
+		},
+		{
+			name:      "bound variadic",
+			directive: "//gomicro:http GET /users query=ids",
+			method:    "Get(ctx context.Context, ids ...string) error",
+			err:       true,
+		},
+		{
+			name:      "unbound without body",
+			directive: "//gomicro:http GET /users/{id}",
+			method:    "Get(ctx context.Context, id string, limit int) error",
+			err:       true,
+		},
+		{
+			name:      "unnamed without body",
+			directive: "//gomicro:http DELETE /users",
+			method:    "Delete(context.Context, string) error",
+			err:       true,
+		},
+		{
+			name:      "blank without body",
+			directive: "//gomicro:http GET /users",
+			method:    "Get(ctx context.Context, _ string) error",
+			err:       true,
+		},
+		{
+			name:      "unnamed with body",
+			directive: "//gomicro:http POST /users",
+			method:    "Post(context.Context, User) error",
+			want:      &HTTPRoute{Verb: "POST", Path: "/users", Status: 200},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api, err := readAPI(t, map[string]string{
+				"users/api.go": `package users
+
+import (
+	"context"
+	gocontext "context"
+)
+
+var _ context.Context
+
+type API interface {
+	` + test.directive + `
+	` + test.method + `
+}
+
+type User struct {
+	Name string
+}
+
+type ID string
+`,
+			})
+			if test.err {
+				if !errors.Is(err, ErrInvalidDirective) {
+					t.Fatalf("got error %v, want %v", err, ErrInvalidDirective)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			route := api.Interfaces[0].Methods[0].HTTP
+			if route != nil {
+				route.Pos = test.want.Pos
+			}
+
+			if !reflect.DeepEqual(route, test.want) {
+				t.Errorf("route %+v, want %+v", route, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package reader
+
+import (
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+// TypeDecl is a named type that is sent over the wire by an API. Structs hold their fields while other types
+// hold the type they are declared as.
+type TypeDecl struct {
+	// Name is the qualified name of the type as used in generated code
+	Name        string
+	PackagePath string
+	Doc         string
+	Pos         token.Position
+
+	// Marshaler is true when the type encodes itself with MarshalJSON or MarshalText in which case its fields
+	// are not walked.
+	Marshaler bool
+
+	Fields     []Field
+	Underlying string
+
+	Type *types.Named
+}
+
+// IsStruct returns true if the type is declared as a struct.
+func (td TypeDecl) IsStruct() bool {
+	_, ok := td.Type.Underlying().(*types.Struct)
+	return ok
+}
+
+// Field is a field of a struct that is sent over the wire.
+type Field struct {
+	Name       string
+	ImportType string
+	Type       types.Type
+	Doc        string
+	Pos        token.Position
+
+	// Tag is the raw struct tag of the field
+	Tag string
+	// JSONName is the name from the field's json tag. It is empty when the field has no json tag and "-"
+	// when the field is skipped.
+	JSONName string
+	HasJSON  bool
+
+	Exported bool
+	Embedded bool
+}
+
+// TypeGraph returns every named type reachable from the parameters and results of the interfaces' methods,
+// through the fields of structs that are sent over the wire, in the order they are first referenced.
+func (r *Reader) TypeGraph(interfaces []Interface) []TypeDecl {
+	g := &typeGraph{
+		r:    r,
+		seen: make(map[*types.Named]bool),
+	}
+
+	for _, it := range interfaces {
+		for _, method := range it.Methods {
+			for _, v := range method.Params {
+				g.visit(v.Type)
+			}
+
+			for _, v := range method.Results {
+				g.visit(v.Type)
+			}
+		}
+	}
+
+	return g.decls
+}
+
+type typeGraph struct {
+	r     *Reader
+	seen  map[*types.Named]bool
+	decls []TypeDecl
+}
+
+func (g *typeGraph) visit(typ types.Type) {
+	switch t := types.Unalias(typ).(type) {
+	case *types.Pointer:
+		g.visit(t.Elem())
+	case *types.Slice:
+		g.visit(t.Elem())
+	case *types.Array:
+		g.visit(t.Elem())
+	case *types.Map:
+		g.visit(t.Key())
+		g.visit(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			g.visit(t.Field(i).Type())
+		}
+	case *types.Named:
+		g.visitNamed(t)
+	}
+}
+
+func (g *typeGraph) visitNamed(n *types.Named) {
+	if g.seen[n] {
+		return
+	}
+	g.seen[n] = true
+
+	// Builtin types such as error and transport types such as context.Context are not sent over the wire
+	obj := n.Obj()
+	if obj.Pkg() == nil || (obj.Pkg().Path() == "context" && obj.Name() == "Context") {
+		return
+	}
+
+	decl := TypeDecl{
+		Name:        g.r.TypeString(n),
+		PackagePath: obj.Pkg().Path(),
+		Doc:         g.r.docAt(obj.Pos()),
+		Pos:         g.r.position(obj.Pos()),
+		Marshaler:   isMarshaler(n),
+		Type:        n,
+	}
+
+	st, ok := n.Underlying().(*types.Struct)
+	if !ok {
+		decl.Underlying = g.r.TypeString(n.Underlying())
+		g.decls = append(g.decls, decl)
+
+		if !decl.Marshaler {
+			g.visit(n.Underlying())
+		}
+		return
+	}
+
+	if decl.Marshaler {
+		g.decls = append(g.decls, decl)
+		return
+	}
+
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		field := Field{
+			Name:       f.Name(),
+			ImportType: g.r.TypeString(f.Type()),
+			Type:       f.Type(),
+			Doc:        g.r.docAt(f.Pos()),
+			Pos:        g.r.position(f.Pos()),
+			Tag:        st.Tag(i),
+			Exported:   f.Exported(),
+			Embedded:   f.Embedded(),
+		}
+
+		if tag, ok := reflect.StructTag(field.Tag).Lookup("json"); ok {
+			field.HasJSON = true
+			field.JSONName = strings.Split(tag, ",")[0]
+		}
+
+		decl.Fields = append(decl.Fields, field)
+	}
+
+	// Declarations are added before the types of their fields so that the graph reads top down
+	g.decls = append(g.decls, decl)
+
+	for _, f := range decl.Fields {
+		// Unexported fields and fields skipped by their json tag are not sent over the wire, except for
+		// embedded structs whose exported fields are promoted.
+		if (!f.Exported && !f.Embedded) || f.JSONName == "-" {
+			continue
+		}
+
+		g.visit(f.Type)
+	}
+}
+
+// isMarshaler returns true if the type or a pointer to it implements json.Marshaler or encoding.TextMarshaler.
+func isMarshaler(n *types.Named) bool {
+	for _, t := range []types.Type{n, types.NewPointer(n)} {
+		ms := types.NewMethodSet(t)
+		for _, name := range []string{"MarshalJSON", "MarshalText"} {
+			if ms.Lookup(n.Obj().Pkg(), name) != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,310 @@
+package reader
+
+import (
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+var errImportCycle = errors.New("import cycle while type checking", errors.WithoutStackTrace())
+
+// packageCache holds the packages imported from outside the module of the packages loaded, keyed by directory,
+// which importers share since the overlay never holds their files. Packages are type checked once even when
+// imported by logicals loaded in parallel.
+type packageCache struct {
+	mu       sync.Mutex
+	packages map[string]*cachedPackage
+	// files holds the syntax trees of the files of every cached package by name to look up doc comments
+	files map[string]*ast.File
+
+	// exportMu guards exports, which imports the standard library from the export data of the go command, and is
+	// nil once that failed
+	exportMu sync.Mutex
+	exports  types.Importer
+}
+
+type cachedPackage struct {
+	once sync.Once
+	pkg  *types.Package
+	err  error
+}
+
+func newPackageCache(fset *token.FileSet) *packageCache {
+	return &packageCache{
+		packages: make(map[string]*cachedPackage),
+		files:    make(map[string]*ast.File),
+		exports:  importer.ForCompiler(fset, "gc", nil),
+	}
+}
+
+// export imports the package of the standard library from its export data, which the go command builds once and
+// caches, since type checking the standard library from source takes seconds. It returns false once that failed,
+// such as without the go command, so that every package of the standard library is type checked from source
+// from then on.
+func (c *packageCache) export(path string) (*types.Package, bool) {
+	c.exportMu.Lock()
+	defer c.exportMu.Unlock()
+
+	if c.exports == nil {
+		return nil, false
+	}
+
+	pkg, err := c.exports.Import(path)
+	if err != nil {
+		c.exports = nil
+		return nil, false
+	}
+
+	return pkg, true
+}
+
+// load returns the package in dir, type checking it with check unless it was already. Imports of the standard
+// library and of other modules never lead back to the package so waiting on those type checked by others never
+// deadlocks.
+func (c *packageCache) load(dir string, check func() (*types.Package, map[string]*ast.File, error)) (*types.Package,
+	error) {
+
+	c.mu.Lock()
+	cp, ok := c.packages[dir]
+	if !ok {
+		cp = new(cachedPackage)
+		c.packages[dir] = cp
+	}
+	c.mu.Unlock()
+
+	cp.once.Do(func() {
+		var files map[string]*ast.File
+		cp.pkg, files, cp.err = check()
+
+		c.mu.Lock()
+		for name, f := range files {
+			c.files[name] = f
+		}
+		c.mu.Unlock()
+	})
+
+	return cp.pkg, cp.err
+}
+
+func (c *packageCache) file(name string) (*ast.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.files[name]
+	return f, ok
+}
+
+// sourceImporter type checks imported packages from source. Import paths are resolved by the build context
+// from its directory so that packages of the module the API belongs to, and its requirements, are found
+// regardless of the process' working directory. Packages of the module are read with the overlay when one is set
+// since they may not be on disk yet, while packages from outside of it are shared by the importers of the loader.
+type sourceImporter struct {
+	loader   *Loader
+	ctxt     build.Context
+	fset     *token.FileSet
+	packages map[string]*types.Package
+	// files holds the syntax trees of every imported file by name to look up doc comments
+	files map[string]*ast.File
+
+	// module is the path of the module the directory belongs to and moduleDir its root
+	module    string
+	moduleDir string
+	// paths maps the directory of every package seen to its import path and imports holds the import paths
+	// that every package imports, which are used to report import cycles
+	paths   map[string]string
+	imports map[string][]string
+}
+
+func newSourceImporter(l *Loader, dir string) *sourceImporter {
+	ctxt := build.Default
+	ctxt.Dir = dir
+	// Without cgo the pure Go implementations of standard library packages are selected
+	ctxt.CgoEnabled = false
+
+	module, moduleDir := findModule(dir)
+
+	return &sourceImporter{
+		loader:    l,
+		ctxt:      ctxt,
+		fset:      l.fset,
+		packages:  make(map[string]*types.Package),
+		files:     make(map[string]*ast.File),
+		module:    module,
+		moduleDir: moduleDir,
+		paths:     make(map[string]string),
+		imports:   make(map[string][]string),
+	}
+}
+
+func (i *sourceImporter) Import(path string) (*types.Package, error) {
+	return i.ImportFrom(path, i.ctxt.Dir, 0)
+}
+
+func (i *sourceImporter) ImportFrom(path, dir string, _ types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+
+	bp, err := i.buildPackage(path, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("import", path))
+	}
+
+	if from, ok := i.paths[filepath.Clean(dir)]; ok {
+		i.imports[from] = append(i.imports[from], bp.ImportPath)
+	}
+	i.paths[bp.Dir] = bp.ImportPath
+
+	pkg, ok := i.packages[bp.ImportPath]
+	if ok {
+		if pkg == nil {
+			return nil, errors.Wrap(errImportCycle, "", j.KV("import", path))
+		}
+
+		return pkg, nil
+	}
+
+	if i.shared(bp) {
+		pkg, err := i.loader.shared.load(bp.Dir, func() (*types.Package, map[string]*ast.File, error) {
+			if bp.Goroot {
+				if pkg, ok := i.loader.shared.export(bp.ImportPath); ok {
+					return pkg, nil, nil
+				}
+			}
+
+			return i.check(bp)
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("import", path))
+		}
+
+		i.packages[bp.ImportPath] = pkg
+		return pkg, nil
+	}
+
+	// Mark the package as in progress to detect import cycles
+	i.packages[bp.ImportPath] = nil
+
+	pkg, files, err := i.check(bp)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("import", path))
+	}
+
+	for name, f := range files {
+		i.files[name] = f
+	}
+	i.packages[bp.ImportPath] = pkg
+
+	return pkg, nil
+}
+
+// shared returns true if the package is from outside the module, which the overlay never holds files of.
+func (i *sourceImporter) shared(bp *build.Package) bool {
+	if bp.Goroot {
+		return true
+	}
+
+	if i.moduleDir == "" {
+		return false
+	}
+
+	rel, err := filepath.Rel(i.moduleDir, bp.Dir)
+	return err == nil && (rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// check parses the files of the package and type checks its declarations, returning the syntax trees by name.
+func (i *sourceImporter) check(bp *build.Package) (*types.Package, map[string]*ast.File, error) {
+	byName := make(map[string]*ast.File)
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		filename := filepath.Join(bp.Dir, name)
+		f, err := parser.ParseFile(i.fset, filename, i.loader.overlaySource(filename), parser.ParseComments)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "")
+		}
+
+		byName[filename] = f
+		files = append(files, f)
+	}
+
+	conf := types.Config{
+		Importer:         i,
+		IgnoreFuncBodies: true,
+		FakeImportC:      true,
+		// Only the exported declarations of imported packages are of interest so errors in the
+		// bodies of their declarations are ignored.
+		Error: func(error) {},
+	}
+
+	pkg, err := conf.Check(bp.ImportPath, i.fset, files, nil)
+	if pkg == nil {
+		return nil, nil, errors.Wrap(err, "")
+	}
+
+	return pkg, byName, nil
+}
+
+// file returns the syntax tree of the imported file by name.
+func (i *sourceImporter) file(name string) *ast.File {
+	if f, ok := i.files[name]; ok {
+		return f
+	}
+
+	f, _ := i.loader.shared.file(name)
+	return f
+}
+
+// buildPackage resolves the import path from the directory of the importing package.
+func (i *sourceImporter) buildPackage(path, dir string) (*build.Package, error) {
+	if i.module == "" || (path != i.module && !strings.HasPrefix(path, i.module+"/")) {
+		return i.ctxt.Import(path, dir, 0)
+	}
+
+	// Packages of the module are found from its root, which sees the overlay that disables module lookups and
+	// spares running the go command for every import
+	pkgDir := filepath.Join(i.moduleDir, filepath.FromSlash(strings.TrimPrefix(path, i.module)))
+	ctxt := i.loader.overlayContext(i.ctxt)
+	bp, err := ctxt.ImportDir(pkgDir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	bp.ImportPath = path
+	return bp, nil
+}
+
+// cycle returns the chain of imports from the import path back to the package at target, if there is one.
+func (i *sourceImporter) cycle(path, target string) []string {
+	seen := make(map[string]bool)
+
+	var visit func(path string) []string
+	visit = func(path string) []string {
+		if path == target {
+			return []string{path}
+		}
+
+		if seen[path] {
+			return nil
+		}
+		seen[path] = true
+
+		for _, imp := range i.imports[path] {
+			if chain := visit(imp); chain != nil {
+				return append([]string{path}, chain...)
+			}
+		}
+
+		return nil
+	}
+
+	return visit(path)
+}
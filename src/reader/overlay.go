@@ -0,0 +1,125 @@
+package reader
+
+import (
+	"bytes"
+	"go/build"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Loader loads packages to read and check them. Files of its overlay take precedence over those on disk. Every
+// generation loads with its own so that generations share no state, while the logicals of a generation share the
+// packages imported from outside the module, such as those of the standard library, which are type checked once.
+type Loader struct {
+	// overlay holds the contents of files keyed by absolute path, such as files the generator has yet to write
+	overlay map[string][]byte
+
+	fset   *token.FileSet
+	shared *packageCache
+}
+
+// NewLoader returns a loader that reads every file from disk.
+func NewLoader() *Loader {
+	fset := token.NewFileSet()
+	return &Loader{fset: fset, shared: newPackageCache(fset)}
+}
+
+// WithOverlay returns a loader that reads the files of the overlay, keyed by absolute path, in place of those on
+// disk. It shares the packages imported from outside the module with l since the overlay never holds their files.
+func (l *Loader) WithOverlay(overlay map[string][]byte) *Loader {
+	return &Loader{overlay: overlay, fset: l.fset, shared: l.shared}
+}
+
+// overlayContext returns the build context that lists and opens the files of the overlay along with those on
+// disk. Setting the file system hooks disables module lookups so it is only used for local directories.
+func (l *Loader) overlayContext(ctxt build.Context) build.Context {
+	if len(l.overlay) == 0 {
+		return ctxt
+	}
+
+	ctxt.IsDir = func(path string) bool {
+		prefix := filepath.Clean(path) + string(filepath.Separator)
+		for name := range l.overlay {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+
+		fi, err := os.Stat(path)
+		return err == nil && fi.IsDir()
+	}
+
+	ctxt.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		byName := make(map[string]os.FileInfo)
+		for _, fi := range infos {
+			byName[fi.Name()] = fi
+		}
+
+		found := err == nil
+		for name, src := range l.overlay {
+			if filepath.Dir(name) != filepath.Clean(dir) {
+				continue
+			}
+
+			found = true
+			byName[filepath.Base(name)] = overlayFile{name: filepath.Base(name), size: int64(len(src))}
+		}
+
+		if !found {
+			return nil, err
+		}
+
+		infos = infos[:0]
+		for _, fi := range byName {
+			infos = append(infos, fi)
+		}
+		sort.Slice(infos, func(i, j int) bool {
+			return infos[i].Name() < infos[j].Name()
+		})
+
+		return infos, nil
+	}
+
+	ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
+		if src, ok := l.overlay[path]; ok {
+			return ioutil.NopCloser(bytes.NewReader(src)), nil
+		}
+
+		return os.Open(path)
+	}
+
+	return ctxt
+}
+
+// overlaySource returns the source of the file for the parser, which is nil when it is read from disk.
+func (l *Loader) overlaySource(path string) interface{} {
+	if src, ok := l.overlay[path]; ok {
+		return src
+	}
+
+	return nil
+}
+
+// overlayFile describes a file of the overlay that is not on disk yet.
+type overlayFile struct {
+	name string
+	size int64
+}
+
+func (f overlayFile) Name() string       { return f.name }
+func (f overlayFile) Size() int64        { return f.size }
+func (f overlayFile) Mode() os.FileMode  { return 0644 }
+func (f overlayFile) ModTime() time.Time { return time.Time{} }
+func (f overlayFile) IsDir() bool        { return false }
+func (f overlayFile) Sys() interface{}   { return nil }
@@ -2,153 +2,892 @@ package reader
 
 import (
 	"go/ast"
+	"go/build"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 )
 
-func ReadAPI(packageName string, path string) ([]FunctionSignature, error) {
-	b, err := ioutil.ReadFile(path)
+// ErrUnsupportedType is returned when an API method uses a type that cannot be sent over the wire.
+var ErrUnsupportedType = errors.New("unsupported type in api method", errors.WithoutStackTrace())
+
+// ErrUnsupportedEmbed is returned when an API interface embeds a type that is not an interface with methods.
+var ErrUnsupportedEmbed = errors.New("unsupported embedded type in api interface", errors.WithoutStackTrace())
+
+// ErrDuplicateMethod is returned when a method is declared more than once across an API interface and the
+// interfaces it embeds.
+var ErrDuplicateMethod = errors.New("duplicate method in api interface", errors.WithoutStackTrace())
+
+// ErrInterfaceNotFound is returned when the configured API interface is not declared in the API file.
+var ErrInterfaceNotFound = errors.New("api interface not found", errors.WithoutStackTrace())
+
+// ErrAmbiguousInterface is returned when no interface name is configured and the API file declares more
+// than one exported interface.
+var ErrAmbiguousInterface = errors.New("api interface is ambiguous", errors.WithoutStackTrace())
+
+// API is what was read from a logical's API file.
+type API struct {
+	// Imports are the import specs of the API file
+	Imports    []Import
+	Interfaces []Interface
+	// Types are the named types reachable from the signatures of the interfaces' methods
+	Types []TypeDecl
+	// Embeds are the positions of the declarations of the interfaces embedded in the API interfaces at any depth
+	Embeds []token.Position
+}
+
+// Import is an import spec with Name holding the alias of the package if it was given one.
+type Import struct {
+	Name string
+	Path string
+}
+
+// Interface is a named interface from the API file along with the signatures of its methods.
+type Interface struct {
+	Name string
+	// Doc is the text of the interface's doc comment
+	Doc     string
+	Methods []FunctionSignature
+}
+
+// ReadAPI reads the interfaces with the provided names from the API file in the order they were asked for.
+// When no names are provided the file must declare exactly one exported interface which is then used.
+//
+// The whole package containing the API file is loaded and type checked so that types declared in other
+// files of the package, aliases and imported types all resolve to their declarations.
+func (l *Loader) ReadAPI(packageName string, path string, interfaceNames ...string) (*API, error) {
+	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "")
 	}
 
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, "", string(b), parser.ParseComments)
+	r, err := l.LoadPackage(packageName, filepath.Dir(absPath))
 	if err != nil {
 		return nil, err
 	}
 
-	r := &Reader{PackageName: packageName}
+	node, ok := r.Files[absPath]
+	if !ok {
+		return nil, errors.New("api file is not part of the package", j.KV("path", path))
+	}
 
-	var fs []FunctionSignature
-	//var localStructs []string
-	// Traverse file tree for interface methods
-	ast.Inspect(node, func(n ast.Node) bool {
-		switch t := n.(type) {
-		// Find variable declarations
-		case *ast.TypeSpec:
-			// Which are public
-			if t.Name.IsExported() {
-				switch assertion := t.Type.(type) {
-				// Which are interfaces
-				case *ast.InterfaceType:
-					fs = r.ListInterfaceMethods(assertion)
-				}
+	// Errors in other files of the package only matter if the API depends on them
+	for _, te := range r.Errors {
+		if te.Fset.Position(te.Pos).Filename == absPath {
+			return nil, errors.Wrap(te, "failed to type check api file", j.KV("path", path))
+		}
+	}
+
+	var imports []Import
+	for _, spec := range node.Imports {
+		imp := Import{Path: strings.Trim(spec.Path.Value, "\"`")}
+		if spec.Name != nil {
+			imp.Name = spec.Name.Name
+		}
+
+		// Aliases are kept so that generated code refers to packages the same way the API does, except
+		// for dot imports which generated code in other packages cannot use.
+		if imp.Name != "" && imp.Name != "." && imp.Name != "_" {
+			r.aliases[imp.Path] = imp.Name
+		}
+
+		imports = append(imports, imp)
+	}
+
+	// Collect all the exported interfaces declared at the top level of the file
+	declared := make(map[string][]*ast.TypeSpec)
+	docs := make(map[*ast.TypeSpec]string)
+	var order []string
+	for _, decl := range node.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gd.Specs {
+			t := spec.(*ast.TypeSpec)
+			// Which are public interfaces
+			if _, ok := t.Type.(*ast.InterfaceType); !ok || !t.Name.IsExported() {
+				continue
+			}
+
+			if _, ok := declared[t.Name.Name]; !ok {
+				order = append(order, t.Name.Name)
+			}
+			declared[t.Name.Name] = append(declared[t.Name.Name], t)
+
+			// The doc comment of a single type declaration belongs to the declaration rather than the spec
+			doc := t.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
 			}
+			docs[t] = doc.Text()
 		}
-		return true
-	})
+	}
 
-	return fs, nil
+	if len(interfaceNames) == 0 {
+		switch len(order) {
+		case 0:
+			return nil, errors.Wrap(ErrInterfaceNotFound, "", j.KV("path", path))
+		case 1:
+			interfaceNames = order
+		default:
+			return nil, errors.Wrap(ErrAmbiguousInterface, "", j.MKV{
+				"path":       path,
+				"interfaces": strings.Join(order, ", "),
+			})
+		}
+	}
+
+	api := &API{Imports: imports}
+	for _, name := range interfaceNames {
+		its := declared[name]
+		if len(its) == 0 {
+			return nil, errors.Wrap(ErrInterfaceNotFound, "", j.MKV{
+				"path":      path,
+				"interface": name,
+			})
+		} else if len(its) > 1 {
+			return nil, errors.Wrap(ErrAmbiguousInterface, "", j.MKV{
+				"path":      path,
+				"interface": name,
+			})
+		}
+
+		fs, err := r.ListInterfaceMethods(its[0].Type.(*ast.InterfaceType))
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("interface", name))
+		}
+
+		api.Interfaces = append(api.Interfaces, Interface{
+			Name:    name,
+			Doc:     docs[its[0]],
+			Methods: fs,
+		})
+	}
+
+	api.Types = r.TypeGraph(api.Interfaces)
+	api.Embeds = r.embeds
+
+	return api, nil
+}
+
+// LoadPackage parses every file of the package in dir that matches the current build context and type checks
+// it. Imported packages are type checked from source using the module the package belongs to so that no network
+// access is required, other than the standard library which is imported from the export data the go command
+// caches when it can. Packages from outside the module are type checked once for all the loads of the loader.
+func (l *Loader) LoadPackage(packageName string, dir string) (*Reader, error) {
+	ctxt := l.overlayContext(build.Default)
+	bp, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("dir", dir))
+	}
+
+	fset := l.fset
+	files := make(map[string]*ast.File)
+	var astFiles []*ast.File
+	for _, name := range bp.GoFiles {
+		path := filepath.Join(dir, name)
+		f, err := parser.ParseFile(fset, path, l.overlaySource(path), parser.ParseComments)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		files[path] = f
+		astFiles = append(astFiles, f)
+	}
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+
+	// Generated files in the package may not compile while they are out of date so only the declarations
+	// are checked and errors are kept for the caller to decide on.
+	var typeErrs []types.Error
+	imp := newSourceImporter(l, dir)
+	conf := types.Config{
+		Importer:         imp,
+		IgnoreFuncBodies: true,
+		Error: func(err error) {
+			if te, ok := err.(types.Error); ok {
+				typeErrs = append(typeErrs, te)
+			}
+		},
+	}
+
+	pkg, _ := conf.Check(importPath(dir, bp.ImportPath), fset, astFiles, info)
+
+	return &Reader{
+		PackageName: packageName,
+		Fset:        fset,
+		Files:       files,
+		Package:     pkg,
+		Info:        info,
+		Errors:      typeErrs,
+		aliases:     make(map[string]string),
+		importer:    imp,
+	}, nil
 }
 
 type FunctionSignature struct {
-	Name string
-	Params []Variable
+	Name    string
+	Params  []Variable
 	Results []Variable
+
+	// Doc is the text of the method's doc comment
+	Doc string
+	// HTTP is the route set by the method's http directive or nil when it has none
+	HTTP *HTTPRoute
+
+	// Pos is the position of the method name in the API file
+	Pos token.Position
 }
 
 type Reader struct {
+	// PackageName is the name the API package is referred to by in generated code
 	PackageName string
+
+	Fset    *token.FileSet
+	Files   map[string]*ast.File
+	Package *types.Package
+	Info    *types.Info
+	// Errors are the type errors found in the package
+	Errors []types.Error
+
+	// aliases maps import paths to the names they were imported as in the API file
+	aliases map[string]string
+	// embeds holds the positions of the embedded interfaces that were flattened
+	embeds []token.Position
+
+	importer *sourceImporter
 }
 
-// ListInterfaceMethods returns the function signatures of all the interface methods
-func (r *Reader) ListInterfaceMethods(it *ast.InterfaceType) []FunctionSignature {
+// ListInterfaceMethods returns the function signatures of all the interface methods including those of
+// embedded interfaces, which are flattened in the order they are embedded.
+func (r *Reader) ListInterfaceMethods(it *ast.InterfaceType) ([]FunctionSignature, error) {
+	return r.listInterfaceMethods(it, make(map[string]FunctionSignature))
+}
+
+func (r *Reader) listInterfaceMethods(it *ast.InterfaceType, seen map[string]FunctionSignature) ([]FunctionSignature, error) {
 	var fsSlice []FunctionSignature
 
 	methods := it.Methods.List
 	for _, method := range methods {
 		fn, ok := method.Type.(*ast.FuncType)
 		if !ok {
+			embedded, err := r.listEmbeddedMethods(method.Type, seen)
+			if err != nil {
+				return nil, err
+			}
+
+			fsSlice = append(fsSlice, embedded...)
 			continue
 		}
 
-		sig := r.CheckFunctionSignature(fn)
-		sig.Name = method.Names[0].Name
+		sig, err := r.CheckFunctionSignature(method.Names[0].Name, fn)
+		if err != nil {
+			return nil, err
+		}
+
+		sig.Pos = r.Fset.Position(method.Names[0].Pos())
+		sig.Doc = method.Doc.Text()
+
+		sig.HTTP, err = r.parseDirectives(sig, method.Doc)
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkDuplicate(sig, seen)
+		if err != nil {
+			return nil, err
+		}
+
+		fsSlice = append(fsSlice, sig)
+	}
+
+	return fsSlice, nil
+}
+
+// listEmbeddedMethods returns the methods of an embedded interface. Interfaces of the API package are read
+// from their declaration while interfaces of other packages are read from their type information.
+func (r *Reader) listEmbeddedMethods(expr ast.Expr, seen map[string]FunctionSignature) ([]FunctionSignature, error) {
+	named, ok := types.Unalias(r.Info.TypeOf(expr)).(*types.Named)
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupportedEmbed, "", j.KV("position", r.Fset.Position(expr.Pos()).String()))
+	}
+
+	iface, ok := named.Underlying().(*types.Interface)
+	if !ok || !iface.IsMethodSet() {
+		return nil, errors.Wrap(ErrUnsupportedEmbed, "", j.KV("interface", named.Obj().Name()))
+	}
+
+	r.embeds = append(r.embeds, r.position(named.Obj().Pos()))
+
+	if named.Obj().Pkg() == r.Package {
+		spec := r.typeSpec(named.Obj().Name())
+		if spec == nil {
+			return nil, errors.Wrap(ErrInterfaceNotFound, "", j.KV("interface", named.Obj().Name()))
+		}
+
+		fs, err := r.listInterfaceMethods(spec.Type.(*ast.InterfaceType), seen)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("embedded", named.Obj().Name()))
+		}
+
+		return fs, nil
+	}
+
+	r.addEmbeds(iface)
+
+	// The method set of an interface from another package includes its own embedded interfaces and is
+	// ordered by declaration.
+	var funcs []*types.Func
+	for i := 0; i < iface.NumMethods(); i++ {
+		funcs = append(funcs, iface.Method(i))
+	}
+	sort.SliceStable(funcs, func(i, j int) bool {
+		return funcs[i].Pos() < funcs[j].Pos()
+	})
+
+	var fsSlice []FunctionSignature
+	for _, fn := range funcs {
+		sig, err := r.signatureFromType(fn)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("embedded", r.TypeString(named)))
+		}
+
+		err = checkDuplicate(sig, seen)
+		if err != nil {
+			return nil, err
+		}
+
 		fsSlice = append(fsSlice, sig)
 	}
 
-	return fsSlice
+	return fsSlice, nil
+}
+
+// addEmbeds records the positions of the interfaces embedded in an interface from another package, which are
+// flattened into its method set rather than read from their declarations.
+func (r *Reader) addEmbeds(iface *types.Interface) {
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		named, ok := types.Unalias(iface.EmbeddedType(i)).(*types.Named)
+		if !ok {
+			continue
+		}
+
+		r.embeds = append(r.embeds, r.position(named.Obj().Pos()))
+		if embedded, ok := named.Underlying().(*types.Interface); ok {
+			r.addEmbeds(embedded)
+		}
+	}
+}
+
+// checkDuplicate returns ErrDuplicateMethod if a method with the same name was already listed.
+func checkDuplicate(sig FunctionSignature, seen map[string]FunctionSignature) error {
+	if prev, ok := seen[sig.Name]; ok {
+		return errors.Wrap(ErrDuplicateMethod, "", j.MKV{
+			"method": sig.Name,
+			"first":  prev.Pos.String(),
+			"second": sig.Pos.String(),
+		})
+	}
+
+	seen[sig.Name] = sig
+	return nil
+}
+
+// typeSpec returns the declaration of the type with the name in the API package.
+func (r *Reader) typeSpec(name string) *ast.TypeSpec {
+	for _, f := range r.Files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range gd.Specs {
+				if ts := spec.(*ast.TypeSpec); ts.Name.Name == name {
+					return ts
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// signatureFromType returns the function signature of a method using only its type information.
+func (r *Reader) signatureFromType(fn *types.Func) (FunctionSignature, error) {
+	sig := fn.Type().(*types.Signature)
+	doc := r.commentAt(fn.Pos())
+	fs := FunctionSignature{
+		Name: fn.Name(),
+		Pos:  r.Fset.Position(fn.Pos()),
+		Doc:  doc.Text(),
+	}
+
+	for i := 0; i < sig.Params().Len(); i++ {
+		p := sig.Params().At(i)
+		v, err := r.newVariable(p.Name(), p.Type(), sig.Variadic() && i == sig.Params().Len()-1, p.Pos())
+		if err != nil {
+			return FunctionSignature{}, errors.Wrap(err, "invalid method parameter", j.MKV{
+				"method": fn.Name(),
+				"param":  variableName(p, i),
+			})
+		}
+
+		fs.Params = append(fs.Params, v)
+	}
+
+	for i := 0; i < sig.Results().Len(); i++ {
+		res := sig.Results().At(i)
+		v, err := r.newVariable(res.Name(), res.Type(), false, res.Pos())
+		if err != nil {
+			return FunctionSignature{}, errors.Wrap(err, "invalid method result", j.MKV{
+				"method": fn.Name(),
+				"result": variableName(res, i),
+			})
+		}
+
+		fs.Results = append(fs.Results, v)
+	}
+
+	route, err := r.parseDirectives(fs, doc)
+	if err != nil {
+		return FunctionSignature{}, err
+	}
+	fs.HTTP = route
+
+	return fs, nil
+}
+
+func variableName(v *types.Var, position int) string {
+	if v.Name() == "" {
+		return "#" + strconv.Itoa(position)
+	}
+
+	return v.Name()
+}
+
+// goroot starts the names of the files of the standard library in export data.
+const goroot = "$GOROOT"
+
+// position returns the position of pos, with the names of the files of the standard library imported from export
+// data made absolute like those of packages type checked from source.
+func (r *Reader) position(pos token.Pos) token.Position {
+	p := r.Fset.Position(pos)
+	if strings.HasPrefix(p.Filename, goroot+"/") {
+		p.Filename = filepath.Join(build.Default.GOROOT, filepath.FromSlash(strings.TrimPrefix(p.Filename, goroot)))
+	}
+
+	return p
 }
 
-func (r *Reader) CheckFunctionSignature(fn *ast.FuncType) FunctionSignature {
-	var fs FunctionSignature
+// docAt returns the text of the doc comment of the type, interface method or struct field declared at the
+// position in any of the parsed files.
+func (r *Reader) docAt(pos token.Pos) string {
+	return r.commentAt(pos).Text()
+}
+
+// commentAt returns the doc comment of the type, interface method or struct field declared at the position
+// including any directives.
+func (r *Reader) commentAt(pos token.Pos) *ast.CommentGroup {
+	f := r.file(pos)
+	if f == nil {
+		return nil
+	}
+
+	var doc *ast.CommentGroup
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch t := n.(type) {
+		case *ast.GenDecl:
+			for _, spec := range t.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || ts.Name.Pos() != pos {
+					continue
+				}
+
+				doc = ts.Doc
+				if doc == nil && len(t.Specs) == 1 {
+					doc = t.Doc
+				}
+				return false
+			}
+		case *ast.Field:
+			for _, name := range t.Names {
+				if name.Pos() == pos {
+					doc = t.Doc
+					return false
+				}
+			}
+		}
+		return doc == nil
+	})
+
+	return doc
+}
+
+// file returns the syntax tree of the file containing the position from the API package or its imports.
+func (r *Reader) file(pos token.Pos) *ast.File {
+	tf := r.Fset.File(pos)
+	if tf == nil {
+		return nil
+	}
+
+	if f, ok := r.Files[tf.Name()]; ok {
+		return f
+	}
+
+	return r.importer.file(tf.Name())
+}
+
+func (r *Reader) CheckFunctionSignature(name string, fn *ast.FuncType) (FunctionSignature, error) {
+	fs := FunctionSignature{Name: name}
 
 	for _, param := range fn.Params.List {
-		fs.Params = append(fs.Params, r.listVariables(param)...)
+		vars, err := r.listVariables(param)
+		if err != nil {
+			return FunctionSignature{}, errors.Wrap(err, "invalid method parameter", j.MKV{
+				"method": name,
+				"param":  fieldName(param, len(fs.Params)),
+			})
+		}
+
+		fs.Params = append(fs.Params, vars...)
+	}
+
+	if fn.Results == nil {
+		return fs, nil
 	}
 
 	for _, result := range fn.Results.List {
-		fs.Results = append(fs.Results, r.listVariables(result)...)
+		vars, err := r.listVariables(result)
+		if err != nil {
+			return FunctionSignature{}, errors.Wrap(err, "invalid method result", j.MKV{
+				"method": name,
+				"result": fieldName(result, len(fs.Results)),
+			})
+		}
+
+		fs.Results = append(fs.Results, vars...)
 	}
 
-	return fs
+	return fs, nil
+}
+
+// fieldName returns the name of the field for error reporting and falls back to
+// its position in the list when the field is unnamed.
+func fieldName(field *ast.Field, position int) string {
+	if len(field.Names) == 0 {
+		return "#" + strconv.Itoa(position)
+	}
+
+	return field.Names[0].Name
 }
 
 type Variable struct {
-	Name string
+	Name       string
 	ImportType string
+
+	// Type is the resolved type of the variable. Variadic parameters have a slice type.
+	Type types.Type
+	// PackagePath is the import path of the package declaring the variable's named type, after
+	// dereferencing pointers. It is empty for builtin and unnamed types.
+	PackagePath string
+
+	// Imports are the packages that ImportType refers to
+	Imports []Import
+
+	// Pos is the position of the variable's name or of its type when it is unnamed
+	Pos token.Position
 }
 
+func (r *Reader) listVariables(field *ast.Field) ([]Variable, error) {
+	var (
+		typ      types.Type
+		variadic bool
+	)
+	if e, ok := field.Type.(*ast.Ellipsis); ok {
+		variadic = true
+		typ = r.Info.TypeOf(e.Elt)
+		if typ != nil {
+			typ = types.NewSlice(typ)
+		}
+	} else {
+		typ = r.Info.TypeOf(field.Type)
+	}
 
-func (r *Reader) listVariables(field *ast.Field) []Variable {
 	// Unnamed variables
 	if len(field.Names) == 0 {
-		return []Variable{
-			{
-				Name:       "",
-				ImportType: r.importTypeFromASTExpr(field.Type),
-			},
+		v, err := r.newVariable("", typ, variadic, field.Type.Pos())
+		if err != nil {
+			return nil, err
 		}
+
+		return []Variable{v}, nil
 	}
 
 	var vr []Variable
 	for _, variable := range field.Names {
-		vr = append(vr, Variable{
-			Name:       variable.Name,
-			ImportType: r.importTypeFromASTExpr(field.Type),
-		})
+		v, err := r.newVariable(variable.Name, typ, variadic, variable.Pos())
+		if err != nil {
+			return nil, err
+		}
+
+		vr = append(vr, v)
 	}
 
-	return vr
+	return vr, nil
 }
 
-// importTypeFromASTExpr returns an empty string if it cannot find the imported type or if the type is not imported
-func (r *Reader) importTypeFromASTExpr(expr ast.Expr) string {
-	switch s := expr.(type) {
-	case *ast.Ident: // internal type handling
-		if !isBuiltInType(s.Name) {
-			return r.PackageName + "." + importTypeFromASTIdent(s)
+// newVariable returns the variable with the type rendered for generated code. Variadic variables have a slice
+// type and are rendered with an ellipsis.
+func (r *Reader) newVariable(name string, typ types.Type, variadic bool, pos token.Pos) (Variable, error) {
+	if typ == nil || typ == types.Typ[types.Invalid] {
+		return Variable{}, errors.Wrap(ErrUnsupportedType, "", j.KV("type", "unresolved"))
+	}
+
+	err := CheckWireType(typ)
+	if err != nil {
+		return Variable{}, err
+	}
+
+	importType := r.TypeString(typ)
+	if variadic {
+		importType = "..." + r.TypeString(typ.(*types.Slice).Elem())
+	}
+
+	return Variable{
+		Name:        name,
+		ImportType:  importType,
+		Type:        typ,
+		PackagePath: packagePath(typ),
+		Imports:     r.TypeImports(typ),
+		Pos:         r.Fset.Position(pos),
+	}, nil
+}
+
+// TypeString returns the Go syntax for the type with every type local to the API package qualified by the
+// logical's package name and imported types qualified the way the API file imports them.
+func (r *Reader) TypeString(typ types.Type) string {
+	return types.TypeString(typ, r.qualifier)
+}
+
+func (r *Reader) qualifier(p *types.Package) string {
+	if p == r.Package {
+		return r.PackageName
+	}
+
+	if alias, ok := r.aliases[p.Path()]; ok {
+		return alias
+	}
+
+	return p.Name()
+}
+
+// TypeImports returns the imports required to refer to the type from another package, named as TypeString
+// qualifies them.
+func (r *Reader) TypeImports(typ types.Type) []Import {
+	var imports []Import
+	seen := make(map[*types.Package]bool)
+	add := func(obj types.Object) {
+		p := obj.Pkg()
+		if p == nil || seen[p] {
+			return
 		}
-		return importTypeFromASTIdent(s)
-	case *ast.SelectorExpr: // external package type handling
-		// convert both package and type abstractions to *ast.Ident types
-		p1, _ := s.X.(*ast.Ident)
-		p2 := s.Sel
+		seen[p] = true
 
-		// return the combined Go syntax for imported types
-		return strings.Join([]string{importTypeFromASTIdent(p1), importTypeFromASTIdent(p2)}, ".")
+		imp := Import{Path: p.Path()}
+		if name := r.qualifier(p); name != p.Name() {
+			imp.Name = name
+		}
+		imports = append(imports, imp)
+	}
+
+	var walk func(t types.Type)
+	walk = func(t types.Type) {
+		switch t := t.(type) {
+		case *types.Alias:
+			add(t.Obj())
+			for i := 0; i < t.TypeArgs().Len(); i++ {
+				walk(t.TypeArgs().At(i))
+			}
+		case *types.Named:
+			add(t.Obj())
+			for i := 0; i < t.TypeArgs().Len(); i++ {
+				walk(t.TypeArgs().At(i))
+			}
+		case *types.Pointer:
+			walk(t.Elem())
+		case *types.Slice:
+			walk(t.Elem())
+		case *types.Array:
+			walk(t.Elem())
+		case *types.Map:
+			walk(t.Key())
+			walk(t.Elem())
+		case *types.Chan:
+			walk(t.Elem())
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				walk(t.Field(i).Type())
+			}
+		}
+	}
+	walk(typ)
+
+	return imports
+}
+
+// CheckWireType returns ErrUnsupportedType for types that cannot be sent over the wire, such as channels,
+// functions and complex numbers, at any level of nesting of unnamed types.
+func CheckWireType(typ types.Type) error {
+	switch t := types.Unalias(typ).(type) {
+	case *types.Named:
+		switch t.Underlying().(type) {
+		case *types.Chan:
+			return errors.Wrap(ErrUnsupportedType, "", j.KV("type", "chan"))
+		case *types.Signature:
+			return errors.Wrap(ErrUnsupportedType, "", j.KV("type", "func"))
+		}
+		return nil
+	case *types.Pointer:
+		return CheckWireType(t.Elem())
+	case *types.Slice:
+		return CheckWireType(t.Elem())
+	case *types.Array:
+		return CheckWireType(t.Elem())
+	case *types.Map:
+		err := CheckWireType(t.Key())
+		if err != nil {
+			return err
+		}
+		return CheckWireType(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			err := CheckWireType(t.Field(i).Type())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *types.Interface:
+		// Only the empty interface can be decoded from the wire
+		if t.NumMethods() > 0 {
+			return errors.Wrap(ErrUnsupportedType, "", j.KV("type", "interface"))
+		}
+		return nil
+	case *types.Chan:
+		return errors.Wrap(ErrUnsupportedType, "", j.KV("type", "chan"))
+	case *types.Signature:
+		return errors.Wrap(ErrUnsupportedType, "", j.KV("type", "func"))
+	case *types.Basic:
+		if t.Info()&types.IsComplex != 0 || t.Kind() == types.UnsafePointer {
+			return errors.Wrap(ErrUnsupportedType, "", j.KV("type", t.Name()))
+		}
+		return nil
 	default:
+		return nil
+	}
+}
+
+// IsContext returns true if the type is context.Context, under any import name.
+func IsContext(typ types.Type) bool {
+	n, ok := types.Unalias(typ).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return false
+	}
+
+	return n.Obj().Pkg().Path() == "context" && n.Obj().Name() == "Context"
+}
+
+// packagePath returns the import path of the named type after dereferencing pointers.
+func packagePath(typ types.Type) string {
+	if p, ok := typ.(*types.Pointer); ok {
+		return packagePath(p.Elem())
+	}
+
+	n, ok := types.Unalias(typ).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
 		return ""
 	}
+
+	return n.Obj().Pkg().Path()
 }
 
-// importTypeFromASTIdent collects the type name and can be used for non-import types in the file tree
-func importTypeFromASTIdent(ident *ast.Ident) string {
-	return ident.Name
+// importPath returns the import path of the package in dir using the closest go.mod file. The path resolved by
+// the build context is used when the package is not part of a module.
+func importPath(dir string, fallback string) string {
+	module, root := findModule(dir)
+	if module == "" {
+		return fallback
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return module
+	}
+
+	return module + "/" + filepath.ToSlash(rel)
 }
 
-func isBuiltInType(typ string) bool {
-	switch typ {
-	case "bool", "byte", "complex128", "complex64", "error":
-	case "float32", "float64":
-	case "int", "int16", "int32", "int64", "int8":
-	case "rune", "string":
-	case "uint", "uint16", "uint32", "uint64", "uint8", "uintptr":
-	default:
-		return false
+// findModule returns the path and the root directory of the module that dir belongs to, which are empty when
+// there is none.
+func findModule(dir string) (string, string) {
+	for d := dir; ; d = filepath.Dir(d) {
+		b, err := ioutil.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			return modulePath(b), d
+		}
+
+		if filepath.Dir(d) == d {
+			return "", ""
+		}
 	}
-	return true
-}
\ No newline at end of file
+}
+
+// modulePath returns the module path declared in the contents of a go.mod file.
+func modulePath(gomod []byte) string {
+	for _, line := range strings.Split(string(gomod), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "module") {
+			continue
+		}
+
+		return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`)
+	}
+
+	return ""
+}
+
+// LowerInitialism lower cases the leading upper case letters of the name such that User becomes user, ID
+// becomes id and HTTPClient becomes httpClient.
+func LowerInitialism(name string) string {
+	rs := []rune(name)
+	for i := range rs {
+		if !unicode.IsUpper(rs[i]) {
+			break
+		}
+
+		// The last upper case letter before a lower case one starts the next word
+		if i > 0 && i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+			break
+		}
+
+		rs[i] = unicode.ToLower(rs[i])
+	}
+
+	return string(rs)
+}
@@ -0,0 +1,347 @@
+package reader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/luno/jettison/errors"
+)
+
+// readAPI writes the files, keyed by path relative to the root of a module named example, and reads the
+// interfaces from users/api.go.
+func readAPI(t *testing.T, files map[string]string, names ...string) (*API, error) {
+	t.Helper()
+
+	root := t.TempDir()
+	files["go.mod"] = "module example\n\ngo 1.23\n"
+	for name, src := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewLoader().ReadAPI("users", filepath.Join(root, "users", "api.go"), names...)
+}
+
+func TestReadAPITypes(t *testing.T) {
+	api, err := readAPI(t, map[string]string{
+		"users/api.go": `package users
+
+import (
+	"context"
+	neturl "net/url"
+	"time"
+
+	"example/shared"
+)
+
+type API interface {
+	Types(ctx context.Context,
+		a int,
+		b []string,
+		c map[string]*time.Time,
+		d [4]byte,
+		e User,
+		f *neturl.URL,
+		g ID,
+		h shared.Page,
+		i any,
+		j struct{ Name string },
+		k ...Option,
+	) error
+}
+`,
+		"users/types.go": `package users
+
+type User struct {
+	Name string ` + "`json:\"name\"`" + `
+}
+
+type ID = string
+
+type Option int
+`,
+		"shared/shared.go": `package shared
+
+type Page struct {
+	Offset int ` + "`json:\"offset\"`" + `
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := api.Interfaces[0].Methods[0].Params
+	tests := []struct {
+		name    string
+		typ     string
+		imports []Import
+	}{
+		{name: "ctx", typ: "context.Context", imports: []Import{{Path: "context"}}},
+		{name: "a", typ: "int"},
+		{name: "b", typ: "[]string"},
+		{name: "c", typ: "map[string]*time.Time", imports: []Import{{Path: "time"}}},
+		{name: "d", typ: "[4]byte"},
+		{name: "e", typ: "users.User", imports: []Import{{Path: "example/users"}}},
+		{name: "f", typ: "*neturl.URL", imports: []Import{{Name: "neturl", Path: "net/url"}}},
+		{name: "g", typ: "users.ID", imports: []Import{{Path: "example/users"}}},
+		{name: "h", typ: "shared.Page", imports: []Import{{Path: "example/shared"}}},
+		{name: "i", typ: "any"},
+		{name: "j", typ: "struct{Name string}"},
+		{name: "k", typ: "...users.Option", imports: []Import{{Path: "example/users"}}},
+	}
+
+	if len(params) != len(tests) {
+		t.Fatalf("read %d params, want %d", len(params), len(tests))
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := params[i]
+			if p.Name != test.name {
+				t.Errorf("name %q, want %q", p.Name, test.name)
+			}
+
+			if p.ImportType != test.typ {
+				t.Errorf("type %q, want %q", p.ImportType, test.typ)
+			}
+
+			if !reflect.DeepEqual(p.Imports, test.imports) {
+				t.Errorf("imports %v, want %v", p.Imports, test.imports)
+			}
+		})
+	}
+
+	wantImports := []Import{{Path: "context"}, {Name: "neturl", Path: "net/url"}, {Path: "time"}, {Path: "example/shared"}}
+	if !reflect.DeepEqual(api.Imports, wantImports) {
+		t.Errorf("api imports %v, want %v", api.Imports, wantImports)
+	}
+}
+
+func TestReadAPIUnsupportedTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		param string
+		err   error
+	}{
+		{name: "channel", param: "c chan int", err: ErrUnsupportedType},
+		{name: "function", param: "f func() error", err: ErrUnsupportedType},
+		{name: "complex", param: "c complex128", err: ErrUnsupportedType},
+		{name: "nested", param: "m map[string][]chan int", err: ErrUnsupportedType},
+		{name: "undeclared", param: "u Undeclared"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readAPI(t, map[string]string{
+				"users/api.go": "package users\n\nimport \"context\"\n\ntype API interface {\n\tDo(ctx context.Context, " +
+					test.param + ") error\n}\n",
+			})
+			if err == nil {
+				t.Fatal("no error")
+			}
+
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestReadAPIInterfaces(t *testing.T) {
+	src := `package users
+
+import "context"
+
+type API interface {
+	Get(ctx context.Context) error
+}
+
+type Admin interface {
+	Delete(ctx context.Context) error
+}
+
+type internal interface {
+	Hidden(ctx context.Context) error
+}
+`
+
+	tests := []struct {
+		name  string
+		src   string
+		names []string
+		want  []string
+		err   error
+	}{
+		{name: "by name", src: src, names: []string{"Admin"}, want: []string{"Admin"}},
+		{name: "in the order asked for", src: src, names: []string{"Admin", "API"}, want: []string{"Admin", "API"}},
+		{name: "ambiguous", src: src, err: ErrAmbiguousInterface},
+		{name: "not found", src: src, names: []string{"Missing"}, err: ErrInterfaceNotFound},
+		{name: "unexported", src: src, names: []string{"internal"}, err: ErrInterfaceNotFound},
+		{
+			name: "only exported interface",
+			src:  "package users\n\nimport \"context\"\n\ntype API interface {\n\tGet(ctx context.Context) error\n}\n",
+			want: []string{"API"},
+		},
+		{name: "none", src: "package users\n\ntype User struct{}\n", err: ErrInterfaceNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api, err := readAPI(t, map[string]string{"users/api.go": test.src}, test.names...)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("got error %v, want %v", err, test.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, it := range api.Interfaces {
+				names = append(names, it.Name)
+			}
+
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("interfaces %v, want %v", names, test.want)
+			}
+		})
+	}
+}
+
+func TestReadAPIEmbedded(t *testing.T) {
+	shared := `package shared
+
+import "context"
+
+type Reader interface {
+	Base
+	Read(ctx context.Context, id string) (string, error)
+}
+
+type Base interface {
+	Ping(ctx context.Context) error
+}
+`
+
+	tests := []struct {
+		name    string
+		src     string
+		methods []string
+		embeds  []string
+		err     error
+	}{
+		{
+			name: "local",
+			src: `type API interface {
+	Writer
+	Get(ctx context.Context) error
+}
+
+type Writer interface {
+	Write(ctx context.Context) error
+}`,
+			methods: []string{"Write", "Get"},
+			embeds:  []string{"users/api.go"},
+		},
+		{
+			name: "other package",
+			src: `type API interface {
+	Get(ctx context.Context) error
+	shared.Reader
+}`,
+			methods: []string{"Get", "Read", "Ping"},
+			embeds:  []string{"shared/shared.go", "shared/shared.go"},
+		},
+		{
+			name: "duplicate",
+			src: `type API interface {
+	shared.Reader
+	Ping(ctx context.Context) error
+}`,
+			err: ErrDuplicateMethod,
+		},
+		{
+			name: "not an interface",
+			src: `type API interface {
+	Get(ctx context.Context) error
+	User
+}
+
+type User struct{}`,
+			err: ErrUnsupportedEmbed,
+		},
+		{
+			name: "type set",
+			src: `type API interface {
+	Get(ctx context.Context) error
+	Number
+}
+
+type Number interface {
+	~int | ~float64
+}`,
+			err: ErrUnsupportedEmbed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api, err := readAPI(t, map[string]string{
+				"users/api.go":     "package users\n\nimport (\n\t\"context\"\n\n\t\"example/shared\"\n)\n\nvar _ shared.Reader\n\n" + test.src + "\n",
+				"shared/shared.go": shared,
+			}, "API")
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("got error %v, want %v", err, test.err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var methods []string
+			for _, m := range api.Interfaces[0].Methods {
+				methods = append(methods, m.Name)
+			}
+
+			if !reflect.DeepEqual(methods, test.methods) {
+				t.Errorf("methods %v, want %v", methods, test.methods)
+			}
+
+			var embeds []string
+			for _, pos := range api.Embeds {
+				embeds = append(embeds, relPath(t, pos.Filename))
+			}
+
+			if !reflect.DeepEqual(embeds, test.embeds) {
+				t.Errorf("embeds %v, want %v", embeds, test.embeds)
+			}
+		})
+	}
+}
+
+// relPath returns the path relative to the root of the module written by readAPI.
+func relPath(t *testing.T, path string) string {
+	t.Helper()
+
+	dir := filepath.Dir(filepath.Dir(path))
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.ToSlash(rel)
+}
@@ -1,8 +1,7 @@
 package templates
 
 import (
-	"os"
-	"text/template"
+	"io"
 )
 
 type DependencyTemplate struct {
@@ -15,8 +14,8 @@ type Dependency struct {
 	ImportedType string
 }
 
-func (dt *DependencyTemplate) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(dependenciesTemplate)).Execute(file, dt)
+func (dt *DependencyTemplate) AddTo(w io.Writer) error {
+	return execute(w, "dependencies", dt)
 }
 
 var dependenciesTemplate = `
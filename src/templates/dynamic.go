@@ -2,7 +2,7 @@ package templates
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"strings"
 	"text/template"
 )
@@ -18,30 +18,62 @@ const (
 	DoubleLineSpace LineSpace = "doubelinebreak"
 )
 
+// funcs are the helper functions available to the templates
+var funcs = template.FuncMap{
+	"comment": comment,
+	"tag":     tag,
+}
+
+// comment renders text as a line comment with every line prefixed by "//" and ending in a new line. Empty
+// text renders nothing so that templates can place it above declarations unconditionally.
+func comment(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			b.WriteString("//\n")
+			continue
+		}
+
+		b.WriteString("// " + line + "\n")
+	}
+
+	return b.String()
+}
+
+// tag renders a struct tag as a raw string literal.
+func tag(tag string) string {
+	return "`" + tag + "`"
+}
+
 type FileConfig []Adder
 
 type Adder interface {
-	AddTo(*os.File) error
+	AddTo(io.Writer) error
 }
 
 type PackageHeader struct {
 	Name string
 }
 
-func (ph *PackageHeader) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(packageHeaderTemplate)).Execute(file, ph)
+func (ph *PackageHeader) AddTo(w io.Writer) error {
+	return execute(w, "packageHeader", ph)
 }
 
 var packageHeaderTemplate = `package {{.Name}}
 `
 
 // Imports must be used as the type for rendering the imports template. It is expected to be called 'Imports'
-// in the provided struct.
+// in the provided struct. A value of the form "name path" imports the path under the given name.
 type Imports struct {
 	Values []string
 }
 
-func (i *Imports) AddTo(file *os.File) error {
+func (i *Imports) AddTo(w io.Writer) error {
 	for index, line := range i.Values {
 		if line == SingleLineSpace.String() {
 			i.Values[index] = ""
@@ -53,9 +85,14 @@ func (i *Imports) AddTo(file *os.File) error {
 			continue
 		}
 
+		if parts := strings.SplitN(line, " ", 2); len(parts) == 2 {
+			i.Values[index] = parts[0] + " \"" + parts[1] + "\""
+			continue
+		}
+
 		i.Values[index] = "\"" + line + "\""
 	}
-	return template.Must(template.New("").Parse(importsTemplate)).Execute(file, i)
+	return execute(w, "imports", i)
 }
 
 var importsTemplate = `
@@ -68,28 +105,38 @@ import (
 
 // Struct is the configuration of a custom struct type to be made. The template expects 'Struct'
 type Struct struct {
-	Name   string
-	Fields map[string]string
+	Name string
+	Doc  string
+	// Fields are rendered in order
+	Fields []Field
+}
+
+// Field is a field of a struct with an optional tag, given without the quotes, and doc comment.
+type Field struct {
+	Name string
+	Type string
+	Tag  string
+	Doc  string
 }
 
-func (s *Struct) AddTo(file *os.File) error {
+func (s *Struct) AddTo(w io.Writer) error {
 	if len(s.Fields) == 0 {
-		return template.Must(template.New("").Parse(emptyStructTemplate)).Execute(file, s)
+		return execute(w, "emptyStruct", s)
 	}
 
-	return template.Must(template.New("").Parse(structTemplate)).Execute(file, s)
+	return execute(w, "struct", s)
 }
 
 var structTemplate = `
-type {{.Name}} struct {
-{{- range $key, $value := .Fields }}
-	{{ $key }} {{ $value }}
+{{ comment .Doc }}type {{.Name}} struct {
+{{- range .Fields }}
+{{ comment .Doc }}	{{ .Name }} {{ .Type }}{{ if .Tag }} {{ tag .Tag }}{{ end }}
 {{- end }}
 }
 `
 
 var emptyStructTemplate = `
-type {{.Name}} struct {}
+{{ comment .Doc }}type {{.Name}} struct {}
 `
 
 // Interface is the configuration of a custom interface type to be made. The template expects 'Interface'
@@ -98,12 +145,12 @@ type Interface struct {
 	Functions []string
 }
 
-func (i *Interface) AddTo(file *os.File) error {
+func (i *Interface) AddTo(w io.Writer) error {
 	if len(i.Functions) == 0 {
-		return template.Must(template.New("").Parse(emptyInterfaceTemplate)).Execute(file, i)
+		return execute(w, "emptyInterface", i)
 	}
 
-	return template.Must(template.New("").Parse(interfaceTemplate)).Execute(file, i)
+	return execute(w, "interface", i)
 }
 
 var interfaceTemplate = `
@@ -124,12 +171,12 @@ type Function struct {
 	OutputParams []string
 }
 
-func (f *Function) AddTo(file *os.File) error {
+func (f *Function) AddTo(w io.Writer) error {
 	if len(f.OutputParams) > 1 {
-		return template.Must(template.New("").Parse(multiReturnFunctionTemplate)).Execute(file, f)
+		return execute(w, "multiReturnFunction", f)
 	}
 
-	return template.Must(template.New("").Parse(singleReturnFunctionTemplate)).Execute(file, f)
+	return execute(w, "singleReturnFunction", f)
 }
 
 var multiReturnFunctionTemplate = `
@@ -146,16 +193,16 @@ type Method struct {
 	OutputParams []string
 }
 
-func (m *Method) AddTo(file *os.File) error {
+func (m *Method) AddTo(w io.Writer) error {
 	// Abstract the method prefix syntax i.e make (cl *Client) from "Client"
 	prefix := strings.ToLower(strings.Split(m.ParentStruct, "")[0])
 	m.ParentStruct = fmt.Sprintf("%s *%s", prefix, m.ParentStruct)
 
 	if len(m.OutputParams) > 1 {
-		return template.Must(template.New("").Parse(multiReturnMethodTemplate)).Execute(file, m)
+		return execute(w, "multiReturnMethod", m)
 	}
 
-	return template.Must(template.New("").Parse(singleReturnMethodTemplate)).Execute(file, m)
+	return execute(w, "singleReturnMethod", m)
 }
 
 var multiReturnMethodTemplate = `
@@ -169,8 +216,8 @@ type Statement struct {
 	Value string
 }
 
-func (s *Statement) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(statementTemplate)).Execute(file, s)
+func (s *Statement) AddTo(w io.Writer) error {
+	return execute(w, "statement", s)
 }
 
 var statementTemplate = `{{.Value}}
@@ -180,16 +227,16 @@ type Comment struct {
 	Value string
 }
 
-func (c *Comment) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(commentTemplate)).Execute(file, c)
+func (c *Comment) AddTo(w io.Writer) error {
+	return execute(w, "comment", c)
 }
 
 var commentTemplate = `// {{.Value}}`
 
 type Linebreak struct {}
 
-func (s *Linebreak) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(linebreakTemplate)).Execute(file, s)
+func (s *Linebreak) AddTo(w io.Writer) error {
+	return execute(w, "linebreak", s)
 }
 
 var linebreakTemplate = `
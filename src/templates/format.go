@@ -0,0 +1,189 @@
+package templates
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// ErrInvalidSource is returned when rendered templates do not parse as Go source.
+var ErrInvalidSource = errors.New("generated source does not parse", errors.WithoutStackTrace())
+
+// Render executes every template of the file from the set into memory and formats the result. Nothing is
+// rendered for an empty file config.
+func (fc FileConfig) Render(s *Set) ([]byte, error) {
+	buf := renderer{set: s}
+	for _, adder := range fc {
+		err := adder.AddTo(&buf)
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+	}
+
+	if buf.Len() == 0 {
+		return nil, nil
+	}
+
+	return Format(buf.Bytes())
+}
+
+// Format removes unused imports from the Go source and formats it like gofmt. Sources that do not parse fail
+// with the offending line.
+func Format(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, sourceError(src, err)
+	}
+
+	removeUnusedImports(f)
+
+	var buf bytes.Buffer
+	err = format.Node(&buf, fset, f)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sourceError wraps ErrInvalidSource with the parse error and the lines around the first error.
+func sourceError(src []byte, err error) error {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return errors.Wrap(ErrInvalidSource, err.Error())
+	}
+
+	pos := list[0].Pos
+	lines := strings.Split(string(src), "\n")
+
+	var context []string
+	for i := pos.Line - 3; i < pos.Line+2; i++ {
+		if i < 0 || i >= len(lines) {
+			continue
+		}
+
+		marker := "  "
+		if i == pos.Line-1 {
+			marker = "> "
+		}
+		context = append(context, marker+strconv.Itoa(i+1)+": "+lines[i])
+	}
+
+	return errors.Wrap(ErrInvalidSource, list[0].Msg, j.MKV{
+		"line":   pos.Line,
+		"column": pos.Column,
+		"source": strings.Join(context, "\n"),
+	})
+}
+
+// removeUnusedImports deletes the imports that no selector in the file refers to. The name of a package is
+// guessed from its import path so imports are only removed when every package the file refers to is matched by
+// an import, which ensures a wrong guess never removes an import that is used.
+func removeUnusedImports(f *ast.File) {
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		// Package qualifiers are the only identifiers that do not resolve within the file
+		if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+			used[id.Name] = true
+		}
+		return true
+	})
+
+	names := make(map[*ast.ImportSpec]string)
+	matched := make(map[string]bool)
+	for _, spec := range f.Imports {
+		name := importName(spec)
+		names[spec] = name
+		matched[name] = true
+	}
+
+	for name := range used {
+		if !matched[name] {
+			return
+		}
+	}
+
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+
+		var specs []ast.Spec
+		for _, spec := range gd.Specs {
+			is := spec.(*ast.ImportSpec)
+			if name := names[is]; name == "_" || name == "." || used[name] {
+				specs = append(specs, spec)
+			}
+		}
+		gd.Specs = specs
+	}
+
+	var decls []ast.Decl
+	for _, decl := range f.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT && len(gd.Specs) == 0 {
+			continue
+		}
+
+		decls = append(decls, decl)
+	}
+	f.Decls = decls
+
+	var imports []*ast.ImportSpec
+	for _, spec := range f.Imports {
+		if name := names[spec]; name == "_" || name == "." || used[name] {
+			imports = append(imports, spec)
+		}
+	}
+	f.Imports = imports
+}
+
+// importName returns the name an import is referred to by, guessing it from the last element of the import path
+// ignoring major version suffixes and the conventional go- prefix and .go suffix.
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+
+	p, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+
+	name := path.Base(p)
+	if isMajorVersion(name) && path.Dir(p) != "." {
+		name = path.Base(path.Dir(p))
+	}
+
+	// gopkg.in style versions such as yaml.v2
+	if i := strings.Index(name, ".v"); i > 0 && isMajorVersion(name[i+1:]) {
+		name = name[:i]
+	}
+
+	name = strings.TrimPrefix(strings.TrimSuffix(name, ".go"), "go-")
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
@@ -0,0 +1,127 @@
+package templates
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"github.com/luno/jettison/errors"
+)
+
+func TestFormatImports(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "unused",
+			src: `package p
+import (
+"context"
+"net/http"
+neturl "net/url"
+"time"
+)
+func f(ctx context.Context, u *neturl.URL) {}
+`,
+			want: []string{`"context"`, `neturl "net/url"`},
+		},
+		{
+			name: "all unused",
+			src: `package p
+import "time"
+func f() {}
+`,
+		},
+		{
+			name: "guessed names",
+			src: `package p
+import (
+"github.com/a/go-toml"
+"gopkg.in/yaml.v2"
+"github.com/b/errors/v3"
+"github.com/c/unused"
+)
+var _ = toml.Marshal
+var _ = yaml.Marshal
+var _ = errors.New
+`,
+			want: []string{`"github.com/a/go-toml"`, `"github.com/b/errors/v3"`, `"gopkg.in/yaml.v2"`},
+		},
+		{
+			name: "unmatched package",
+			src: `package p
+import (
+"github.com/c/unused"
+"github.com/d/pkg-name"
+)
+var _ = pkgname.X
+`,
+			want: []string{`"github.com/c/unused"`, `"github.com/d/pkg-name"`},
+		},
+		{
+			name: "blank and dot",
+			src: `package p
+import (
+_ "embed"
+. "strings"
+)
+`,
+			want: []string{`_ "embed"`, `. "strings"`},
+		},
+		{
+			name: "locals are not packages",
+			src: `package p
+import "time"
+type s struct{ time int }
+func f(v s) int { return v.time }
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := Format([]byte(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := parser.ParseFile(token.NewFileSet(), "", b, parser.ImportsOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var imports []string
+			for _, spec := range f.Imports {
+				imp := spec.Path.Value
+				if spec.Name != nil {
+					imp = spec.Name.Name + " " + imp
+				}
+				imports = append(imports, imp)
+			}
+
+			if !reflect.DeepEqual(imports, test.want) {
+				t.Errorf("imports %v, want %v", imports, test.want)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	b, err := Format([]byte("package p\nfunc f( a int ) int {\nreturn a}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "package p\n\nfunc f(a int) int {\n\treturn a\n}\n"
+	if string(b) != want {
+		t.Errorf("got %q, want %q", b, want)
+	}
+
+	_, err = Format([]byte("package p\n\nfunc f() {\n"))
+	if !errors.Is(err, ErrInvalidSource) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidSource)
+	}
+}
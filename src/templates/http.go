@@ -1,117 +1,175 @@
 package templates
 
 import (
-	"os"
-	"text/template"
+	"io"
+
+	"gomicro/reader"
 )
 
 type HttpClientType struct {
-	API string
+	// Prefix is prepended to the generated type names when more than one interface is generated for a logical
+	Prefix string
+	API    string
+	Doc    string
+	// Types are the named types sent over the wire by the API
+	Types []reader.TypeDecl
 }
 
-func (f *HttpClientType) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(httpClientTypeTemplate)).Execute(file, f)
+func (f *HttpClientType) AddTo(w io.Writer) error {
+	return execute(w, "httpClientType", f)
 }
 
 var httpClientTypeTemplate = `
-func New(serverAddress string) {{.API}} {
-	return &Client{
+func New{{.Prefix}}(serverAddress string) {{.API}} {
+	return &{{.Prefix}}Client{
 		Address: serverAddress,
 		HttpClient: &http.Client{},
 	}
 }
 
-type Client struct {
+{{ comment .Doc }}type {{.Prefix}}Client struct {
 	Address string
 	HttpClient *http.Client
 }
 `
 
 type HttpRegister struct {
-	API          string
-	Handlers  []Handler
+	Prefix   string
+	API      string
+	Handlers []Handler
+	// Types are the named types sent over the wire by the API
+	Types []reader.TypeDecl
 }
 
 type Handler struct {
-	URI string
-	Method string
+	// Pattern is what the handler is registered with on the http.ServeMux
+	Pattern string
+	Method  string
 }
 
-func (f *HttpRegister) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(httpHandlerRegistration)).Execute(file, f)
+func (f *HttpRegister) AddTo(w io.Writer) error {
+	return execute(w, "httpHandlerRegistration", f)
 }
 
 var httpHandlerRegistration = `
-func RegisterHandlers(api {{.API}}) {
+func Register{{.Prefix}}Handlers(api {{.API}}) {
 {{- range $key, $value := .Handlers }}
-	http.HandleFunc("/{{$value.URI}}", Handle{{$value.Method}}(api))
+	http.HandleFunc("{{$value.Pattern}}", Handle{{$.Prefix}}{{$value.Method}}(api))
 {{- end }}
 }
 `
 
 type HttpHandler struct {
-	Method         string
-	API            string
-	RequestType    string
-	Params         []string
-	Results        []string
-	ResponseType   string
-	ResponseParams []string
+	Doc          string
+	Prefix       string
+	Method       string
+	API          string
+	RequestType  string
+	// Params are the arguments passed to the API method and Results are the locals its results are assigned to
+	Params       []string
+	Results      []string
+	ResponseType string
+	Response     []FieldValue
+
+	// Body is true when the request is decoded from a json body
+	Body     bool
+	Bindings []Binding
+	// Status is the status code of successful responses and NoContent is true when they have no body
+	Status    string
+	NoContent bool
+}
+
+// FieldValue sets a field of a struct to the value of an expression.
+type FieldValue struct {
+	Field string
+	Value string
 }
 
-func (f *HttpHandler) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(httpHandlerTemplate)).Execute(file, f)
+// Binding sets a request field from the text of a path or query parameter. The text s is parsed into v by Parse
+// unless the field is a string, and Value is assigned to the field.
+type Binding struct {
+	Field  string
+	Source string
+	Parse  string
+	Value  string
+}
+
+func (f *HttpHandler) AddTo(w io.Writer) error {
+	return execute(w, "httpHandler", f)
 }
 
 var httpHandlerTemplate = `
-func Handle{{.Method}}(api {{.API}}) func(http.ResponseWriter, *http.Request) {
+{{ comment .Doc }}func Handle{{.Prefix}}{{.Method}}(api {{.API}}) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+{{- if or .Body .Params }}
+		var req {{.RequestType}}
+{{- end }}
+{{- if .Body }}
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			_, _ = w.Write([]byte(err.Error()))
-			w.WriteHeader(http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		var req {{.RequestType}}
 		err = json.Unmarshal(b, &req)
 		if err != nil {
-			_, _ = w.Write([]byte(err.Error()))
-			w.WriteHeader(http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+{{- end }}
+{{- range .Bindings }}
+
+		if s := {{ .Source }}; s != "" {
+{{- if .Parse }}
+			v, err := {{ .Parse }}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+{{ end }}
+			req.{{ .Field }} = {{ .Value }}
+		}
+{{- end }}
 
-		{{ range $key, $value := .Results }}{{if $key}}, {{end}}{{ $value }}{{ end }}{{ if eq (len .Results) 1 }} = {{ end }}{{ if not (eq (len .Results) 1) }} := {{ end }}api.{{.Method}}(r.Context(){{range $key, $value := .Params }}, req.{{ $value }}{{end }})
+		{{ range $key, $value := .Results }}{{if $key}}, {{end}}{{ $value }}{{ end }}{{ if and .Body (eq (len .Results) 1) }} = {{ else }} := {{ end }}api.{{.Method}}(r.Context(){{range $key, $value := .Params }}, {{ $value }}{{end }})
 		if err != nil {
-			_, _ = w.Write([]byte(err.Error()))
-			w.WriteHeader(http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-
+{{ if .NoContent }}
+		w.WriteHeader({{ .Status }})
+{{- else }}
 		var resp {{.ResponseType}}
-		{{range $key, $value := .ResponseParams }}{{if $key}}, {{end}}{{if eq $value "_"}}{{else if $value}}resp.{{end}}{{$value}}{{end}} = {{ range $key, $value := .Results }}{{if $key}}, {{end}}{{ $value }}{{ end }}
-	
+{{- range .Response }}
+		resp.{{ .Field }} = {{ .Value }}
+{{- end }}
+
 		respBody, err := json.Marshal(resp)
 		if err != nil {
-			_, _ = w.Write([]byte(err.Error()))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		
-		_, err = w.Write(respBody)
-		if err != nil {
-			_, _ = w.Write([]byte(err.Error()))
-			w.WriteHeader(http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader({{ .Status }})
+		_, _ = w.Write(respBody)
+{{- end }}
 	}
 }
 `
 
 type HttpClient struct {
-	Service string
+	Doc    string
+	Prefix string
+
+	Verb string
+	// Path is the expression that builds the path of the request
+	Path  string
+	Query []QueryParam
+	// Body is true when the request is sent as a json body
+	Body bool
+	// Status is the status code of successful responses
+	Status string
 
 	Type    string
 	Method  string
@@ -119,7 +177,8 @@ type HttpClient struct {
 	Results []string
 
 	RequestType string
-	Request     map[string]string
+	// Request holds the value of every field of the request in order
+	Request []FieldValue
 
 	ResponseType   string
 	ResponseParams []string
@@ -127,15 +186,32 @@ type HttpClient struct {
 	Return []string
 }
 
-func (cl *HttpClient) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(httpClientTemplate)).Execute(file, cl)
+// QueryParam is a query parameter of a request with Value the expression that formats it.
+type QueryParam struct {
+	Key   string
+	Value string
+}
+
+func (cl *HttpClient) AddTo(w io.Writer) error {
+	return execute(w, "httpClient", cl)
 }
 
 var httpClientTemplate = `
-func (c * Client) {{.Method}}(ctx context.Context{{ range $key, $value := .Params }}, {{ $value }}{{ end }}) ({{- range $key, $value := .Results }}{{if $key}}, {{end}}{{ $value }}{{- end }}) {
+{{ comment .Doc }}func (c * {{.Prefix}}Client) {{.Method}}(ctx context.Context{{ range $key, $value := .Params }}, {{ $value }}{{ end }}) ({{- range $key, $value := .Results }}{{if $key}}, {{end}}{{ $value }}{{- end }}) {
+	uniquePath := {{ .Path }}
+{{- if .Query }}
+
+	query := make(url.Values)
+{{- range .Query }}
+	query.Set("{{ .Key }}", {{ .Value }})
+{{- end }}
+	uniquePath += "?" + query.Encode()
+{{- end }}
+{{- if .Body }}
+
 	req := {{.RequestType}} {
-	{{- range $key, $value := .Request }}
-		{{$key}}: {{$value}},
+	{{- range .Request }}
+		{{ .Field }}: {{ .Value }},
 	{{- end}}
 	}
 
@@ -144,61 +220,87 @@ func (c * Client) {{.Method}}(ctx context.Context{{ range $key, $value := .Param
 		return {{ range $key, $value := .Return }}{{if $key}}, {{end}}{{ $value }}{{ end }}
 	}
 
-	uniquePath := "/{{.Service}}/{{.Method}}"
-	buf := bytes.NewBuffer(b)
-	httpResp, err := ctxhttp.Post(ctx, c.HttpClient, c.Address + uniquePath, "application/json", buf)
+	httpReq, err := http.NewRequest("{{.Verb}}", c.Address + uniquePath, bytes.NewReader(b))
+	if err != nil {
+		return {{ range $key, $value := .Return }}{{if $key}}, {{end}}{{ $value }}{{ end }}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+{{- else }}
+
+	httpReq, err := http.NewRequest("{{.Verb}}", c.Address + uniquePath, nil)
 	if err != nil {
 		return {{ range $key, $value := .Return }}{{if $key}}, {{end}}{{ $value }}{{ end }}
 	}
+{{- end }}
+
+	httpResp, err := ctxhttp.Do(ctx, c.HttpClient, httpReq)
+	if err != nil {
+		return {{ range $key, $value := .Return }}{{if $key}}, {{end}}{{ $value }}{{ end }}
+	}
+	defer httpResp.Body.Close()
 
 	respBody, err := ioutil.ReadAll(httpResp.Body)
 	if err != nil {
 		return {{ range $key, $value := .Return }}{{if $key}}, {{end}}{{ $value }}{{ end }}
 	}
 
+	if httpResp.StatusCode != {{ .Status }} {
+		err = fmt.Errorf("%s: %s", httpResp.Status, respBody)
+		return {{ range $key, $value := .Return }}{{if $key}}, {{end}}{{ $value }}{{ end }}
+	}
+{{ if .ResponseParams }}
 	var resp {{.ResponseType}}
 	err = json.Unmarshal(respBody, &resp)
 	if err != nil {
 		return {{ range $key, $value := .Return }}{{if $key}}, {{end}}{{ $value }}{{ end }}
 	}
 
-	{{ if not (eq (len .ResponseParams) 0)}}return {{range $key, $value := .ResponseParams }}{{if $key}}, {{end}}{{if eq $value "_"}}{{else if $value}}resp.{{end}}{{$value}}{{end}}, nil{{end}}{{ if eq (len .ResponseParams) 0}}return nil{{end}}
+	return {{range $key, $value := .ResponseParams }}{{if $key}}, {{end}}resp.{{$value}}{{end}}, nil
+{{- else }}
+	return nil
+{{- end }}
 }
 `
 
 type LogicalClientType struct {
-	API string
+	Prefix string
+	API    string
+	Doc    string
+	// Types are the named types sent over the wire by the API
+	Types []reader.TypeDecl
 }
 
-func (f *LogicalClientType) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(logicalClientTypeTemplate)).Execute(file, f)
+func (f *LogicalClientType) AddTo(w io.Writer) error {
+	return execute(w, "logicalClientType", f)
 }
 
 var logicalClientTypeTemplate = `
-func New() {{.API}} {
-	return &Client{
+func New{{.Prefix}}() {{.API}} {
+	return &{{.Prefix}}Client{
 		ServerImpl: &server.Server{},
 	}
 }
 
-type Client struct {
+{{ comment .Doc }}type {{.Prefix}}Client struct {
 	ServerImpl {{.API}}
 }
 `
 
 type LogicalClientTemplate struct {
+	Doc          string
+	Prefix       string
 	Method       string
 	Params       []string
 	InlineParams []string
 	Results      []string
 }
 
-func (f *LogicalClientTemplate) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(logicalClientTemplate)).Execute(file, f)
+func (f *LogicalClientTemplate) AddTo(w io.Writer) error {
+	return execute(w, "logicalClient", f)
 }
 
 var logicalClientTemplate = `
-func (cl *Client) {{.Method}}(ctx context.Context{{ range $key, $value := .Params }}, {{ $value }}{{ end }}) ({{- range $key, $value := .Results }}{{if $key}}, {{end}}{{ $value }}{{- end }}) {
+{{ comment .Doc }}func (cl *{{.Prefix}}Client) {{.Method}}(ctx context.Context{{ range $key, $value := .Params }}, {{ $value }}{{ end }}) ({{- range $key, $value := .Results }}{{if $key}}, {{end}}{{ $value }}{{- end }}) {
 	return cl.ServerImpl.{{.Method}}(ctx{{ range $key, $value := .InlineParams }}, {{ $value }}{{ end }})
 }
 `
@@ -0,0 +1,67 @@
+package templates
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// Origin is the template that rendered a top-level declaration of a generated file.
+type Origin struct {
+	Template string
+	// Method is the API method the declaration was rendered for, if any
+	Method string
+}
+
+// Origins returns the origin of every top-level declaration of the file rendered from the set other than imports,
+// in the order they appear. Formatting keeps the declarations in the order they were rendered so the origins line
+// up with those of the formatted file.
+func (fc FileConfig) Origins(s *Set) ([]Origin, error) {
+	var origins []Origin
+	for _, adder := range fc {
+		t := renderer{set: s}
+		err := adder.AddTo(&t)
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+
+		// The package clause and imports are not declarations that are counted
+		src := strings.TrimSpace(t.String())
+		if len(t.names) == 0 || src == "" || strings.HasPrefix(src, "package") || strings.HasPrefix(src, "import") {
+			continue
+		}
+
+		f, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+src, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("template", t.names[0]))
+		}
+
+		for _, decl := range f.Decls {
+			if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+				continue
+			}
+
+			origins = append(origins, Origin{Template: t.names[0], Method: method(adder)})
+		}
+	}
+
+	return origins, nil
+}
+
+// method returns the API method that the templates of transports are rendered for.
+func method(a Adder) string {
+	switch a := a.(type) {
+	case *HttpHandler:
+		return a.Method
+	case *HttpClient:
+		return a.Method
+	case *LogicalClientTemplate:
+		return a.Method
+	}
+
+	return ""
+}
@@ -0,0 +1,236 @@
+package templates
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// ErrUnknownTemplate is returned when an override does not match the name of a built-in template.
+var ErrUnknownTemplate = errors.New("unknown template", errors.WithoutStackTrace())
+
+// ErrInvalidTemplate is returned when an override does not parse or fails to execute with the data of the
+// template it replaces.
+var ErrInvalidTemplate = errors.New("invalid template", errors.WithoutStackTrace())
+
+// OverrideExt is the extension of the files in a template override directory, which are named after the
+// template they replace.
+const OverrideExt = ".tmpl"
+
+type namedTemplate struct {
+	text string
+	// data is the type of value the template is executed with
+	data interface{}
+	tmpl *template.Template
+}
+
+// registry holds every built-in template by name.
+var registry = map[string]*namedTemplate{
+	"packageHeader":           {text: packageHeaderTemplate, data: &PackageHeader{}},
+	"imports":                 {text: importsTemplate, data: &Imports{}},
+	"struct":                  {text: structTemplate, data: &Struct{}},
+	"emptyStruct":             {text: emptyStructTemplate, data: &Struct{}},
+	"interface":               {text: interfaceTemplate, data: &Interface{}},
+	"emptyInterface":          {text: emptyInterfaceTemplate, data: &Interface{}},
+	"multiReturnFunction":     {text: multiReturnFunctionTemplate, data: &Function{}},
+	"singleReturnFunction":    {text: singleReturnFunctionTemplate, data: &Function{}},
+	"multiReturnMethod":       {text: multiReturnMethodTemplate, data: &Method{}},
+	"singleReturnMethod":      {text: singleReturnMethodTemplate, data: &Method{}},
+	"statement":               {text: statementTemplate, data: &Statement{}},
+	"comment":                 {text: commentTemplate, data: &Comment{}},
+	"linebreak":               {text: linebreakTemplate, data: &Linebreak{}},
+	"httpClientType":          {text: httpClientTypeTemplate, data: &HttpClientType{}},
+	"httpHandlerRegistration": {text: httpHandlerRegistration, data: &HttpRegister{}},
+	"httpHandler":             {text: httpHandlerTemplate, data: &HttpHandler{}},
+	"httpClient":              {text: httpClientTemplate, data: &HttpClient{}},
+	"logicalClientType":       {text: logicalClientTypeTemplate, data: &LogicalClientType{}},
+	"logicalClient":           {text: logicalClientTemplate, data: &LogicalClientTemplate{}},
+	"runtimeSetup":            {text: runtimeSetup, data: &RuntimeSetup{}},
+	"dependencies":            {text: dependenciesTemplate, data: &DependencyTemplate{}},
+}
+
+// Set is the templates that files are rendered with, being the built-in templates and the overrides loaded from a
+// directory by name, which take precedence over them. A nil Set renders with the built-in templates.
+type Set struct {
+	overrides map[string]*namedTemplate
+}
+
+// lookup returns the named template of the set.
+func (s *Set) lookup(name string) *namedTemplate {
+	if s != nil {
+		if override, ok := s.overrides[name]; ok {
+			return override
+		}
+	}
+
+	return registry[name]
+}
+
+func init() {
+	for name, nt := range registry {
+		nt.tmpl = template.Must(parse(name, nt.text))
+	}
+}
+
+func parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(funcs).Parse(text)
+}
+
+// renderer is what file configs are rendered into. It carries the set that the templates are taken from and records
+// the names of the templates executed.
+type renderer struct {
+	bytes.Buffer
+	set   *Set
+	names []string
+}
+
+// execute renders the named template with data, taken from the set of w when it is a renderer.
+func execute(w io.Writer, name string, data interface{}) error {
+	nt := registry[name]
+	if r, ok := w.(*renderer); ok {
+		nt = r.set.lookup(name)
+		r.names = append(r.names, name)
+	}
+
+	err := nt.tmpl.Execute(w, data)
+	if err != nil {
+		return errors.Wrap(err, "", j.KV("template", name))
+	}
+
+	return nil
+}
+
+// Fingerprint returns a hash of the templates of the set, including overrides, which changes whenever generated
+// code may change.
+func (s *Set) Fingerprint() string {
+	h := sha256.New()
+	for _, name := range Names() {
+		nt := s.lookup(name)
+		fmt.Fprintf(h, "%s\x00%s\x00", name, nt.text)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Defaults returns the text of every built-in template keyed by name.
+func Defaults() map[string]string {
+	defaults := make(map[string]string)
+	for name, nt := range registry {
+		defaults[name] = nt.text
+	}
+
+	return defaults
+}
+
+// Names returns the name of every template in order.
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// LoadOverrides returns the set that replaces the built-in templates with the files in dir named after them, such
+// as httpHandler.tmpl. Every override is validated before any is used so that an invalid override fails at
+// startup rather than halfway through generation. Other files are ignored.
+func LoadOverrides(dir string) (*Set, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KV("dir", dir))
+	}
+
+	loaded := make(map[string]*namedTemplate)
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != OverrideExt {
+			continue
+		}
+
+		path := filepath.Join(dir, info.Name())
+		name := strings.TrimSuffix(info.Name(), OverrideExt)
+		nt, ok := registry[name]
+		if !ok {
+			return nil, errors.Wrap(ErrUnknownTemplate, "", j.MKV{"path": path, "template": name})
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		override, err := validate(name, string(b), nt.data)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("path", path))
+		}
+
+		loaded[name] = override
+	}
+
+	return &Set{overrides: loaded}, nil
+}
+
+// validate parses the text of the named template and executes it with examples of its data, once with every
+// bool false and once with every bool true so that both sides of conditionals on them are checked.
+func validate(name, text string, data interface{}) (*namedTemplate, error) {
+	t, err := parse(name, text)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidTemplate, err.Error(), j.KV("template", name))
+	}
+
+	for _, flag := range []bool{false, true} {
+		example := reflect.New(reflect.TypeOf(data).Elem())
+		fill(example.Elem(), flag)
+
+		err := t.Execute(ioutil.Discard, example.Interface())
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidTemplate, err.Error(), j.KV("template", name))
+		}
+	}
+
+	return &namedTemplate{text: text, data: data, tmpl: t}, nil
+}
+
+// fill sets every field of v to an example value, giving slices and maps a single element so that the bodies of
+// ranges over them are executed.
+func fill(v reflect.Value, flag bool) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(flag)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fill(v.Field(i), flag)
+			}
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0), flag)
+	case reflect.Map:
+		key := reflect.New(v.Type().Key()).Elem()
+		fill(key, flag)
+		elem := reflect.New(v.Type().Elem()).Elem()
+		fill(elem, flag)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(key, elem)
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem(), flag)
+	}
+}
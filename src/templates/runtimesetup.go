@@ -1,14 +1,16 @@
 package templates
 
 import (
-	"os"
-	"text/template"
+	"io"
 )
 
-type RuntimeSetup struct {}
+type RuntimeSetup struct {
+	// Registers holds the prefix of each generated RegisterHandlers function to call
+	Registers []string
+}
 
-func (f *RuntimeSetup) AddTo(file *os.File) error {
-	return template.Must(template.New("").Parse(runtimeSetup)).Execute(file, f)
+func (f *RuntimeSetup) AddTo(w io.Writer) error {
+	return execute(w, "runtimeSetup", f)
 }
 
 var runtimeSetup = `
@@ -16,7 +18,9 @@ func Run(d *dependencies.Dependencies) error {
 	serverImpl := &server.Server{
 		Dependencies: d,
 	}
-	server.RegisterHandlers(serverImpl)
+{{- range $key, $value := .Registers }}
+	server.Register{{ $value }}Handlers(serverImpl)
+{{- end }}
 
 	return nil
 }
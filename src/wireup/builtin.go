@@ -0,0 +1,246 @@
+package wireup
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+
+	"gomicro/config"
+	"gomicro/templates"
+)
+
+// httpServer generates the http handlers of every API interface of the logical along with the user owned Server
+// type that implements them.
+type httpServer struct{}
+
+func (httpServer) Name() string {
+	return GeneratorHTTPServer
+}
+
+func (httpServer) Inputs(e *Env, logical config.Logical) ([]string, error) {
+	return apiInputs(e, logical)
+}
+
+func (httpServer) Outputs(e *Env, logical config.Logical) ([]string, error) {
+	return apiOutputs(e, logical, "server", "server_gen.go")
+}
+
+func (httpServer) Run(e *Env, logical config.Logical) error {
+	api, routes, err := LoadAPI(e, logical)
+	if err != nil || api == nil {
+		return err
+	}
+
+	err = CreateServerType(e, logical, api.Interfaces)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	for i, it := range api.Interfaces {
+		err = CreateServerImpl(e, logical, it, interfacePrefix(i, it.Name), api.Types, routes[it.Name])
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+
+	return nil
+}
+
+// httpClient generates the http client of every API interface of the logical.
+type httpClient struct{}
+
+func (httpClient) Name() string {
+	return GeneratorHTTPClient
+}
+
+func (httpClient) Inputs(e *Env, logical config.Logical) ([]string, error) {
+	return apiInputs(e, logical)
+}
+
+func (httpClient) Outputs(e *Env, logical config.Logical) ([]string, error) {
+	return apiOutputs(e, logical, filepath.Join("client", "http"), "client_gen.go")
+}
+
+func (httpClient) Run(e *Env, logical config.Logical) error {
+	api, routes, err := LoadAPI(e, logical)
+	if err != nil || api == nil {
+		return err
+	}
+
+	for i, it := range api.Interfaces {
+		err = CreateHttpClientImpl(e, logical, it, interfacePrefix(i, it.Name), api.Types, routes[it.Name])
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+
+	return nil
+}
+
+// logicalClient generates the client of every API interface of the logical that calls the server in process.
+type logicalClient struct{}
+
+func (logicalClient) Name() string {
+	return GeneratorLogicalClient
+}
+
+func (logicalClient) Inputs(e *Env, logical config.Logical) ([]string, error) {
+	return apiInputs(e, logical)
+}
+
+func (logicalClient) Outputs(e *Env, logical config.Logical) ([]string, error) {
+	return apiOutputs(e, logical, filepath.Join("client", "logical"), "client_gen.go")
+}
+
+func (logicalClient) Run(e *Env, logical config.Logical) error {
+	api, _, err := LoadAPI(e, logical)
+	if err != nil || api == nil {
+		return err
+	}
+
+	for i, it := range api.Interfaces {
+		err = CreateLogicalClientImpl(e, logical, it, interfacePrefix(i, it.Name), api.Types)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+
+	return nil
+}
+
+// dependencies generates the Dependencies type of the logical from the dependencies in the config.
+type dependencies struct{}
+
+func (dependencies) Name() string {
+	return GeneratorDependencies
+}
+
+func (dependencies) Inputs(e *Env, logical config.Logical) ([]string, error) {
+	return nil, nil
+}
+
+func (dependencies) Outputs(e *Env, logical config.Logical) ([]string, error) {
+	return []string{filepath.Join(e.logicalDir(logical), "dependencies", "dependencies.go")}, nil
+}
+
+func (dependencies) Run(e *Env, logical config.Logical) error {
+	dir := e.logicalDir(logical)
+
+	// 6.2 Ensure that dependencies are built out
+	err := e.Output.CreateDirIfNotExists(filepath.Join(dir, "dependencies"))
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	var deps []templates.Dependency
+	var imports []string
+	for _, d := range logical.Dependencies {
+		deps = append(deps, templates.Dependency{
+			GetterName:   d.Name,
+			VariableName: strings.ToLower(d.Name),
+			ImportedType: d.Type,
+		})
+
+		imports = append(imports, d.Path)
+	}
+
+	err = e.Output.WriteFile(filepath.Join(dir, "dependencies", "dependencies.go"), templates.FileConfig{
+		&templates.PackageHeader{Name: "dependencies"},
+		&templates.Imports{Values: imports},
+		&templates.DependencyTemplate{Deps: deps},
+	})
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	return nil
+}
+
+// runtimeSetup generates the Run function of the logical that registers the http handlers of its API interfaces.
+type runtimeSetup struct{}
+
+func (runtimeSetup) Name() string {
+	return GeneratorRuntime
+}
+
+func (runtimeSetup) Inputs(e *Env, logical config.Logical) ([]string, error) {
+	return nil, nil
+}
+
+func (runtimeSetup) Outputs(e *Env, logical config.Logical) ([]string, error) {
+	return []string{filepath.Join(e.logicalDir(logical), logical.Name+".go")}, nil
+}
+
+func (runtimeSetup) Run(e *Env, logical config.Logical) error {
+	names, err := APIInterfaces(logical)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	// The logical's API interface is always registered without a prefix
+	rs := templates.RuntimeSetup{Registers: []string{""}}
+	if len(names) > 1 {
+		rs.Registers = append(rs.Registers, names[1:]...)
+	}
+
+	err = e.Output.WriteFile(filepath.Join(e.logicalDir(logical), logical.Name+".go"), templates.FileConfig{
+		&templates.PackageHeader{Name: logical.Name},
+		&templates.Imports{
+			Values: []string{
+				strings.Join([]string{e.Config.Module, e.Config.Service.Name, logical.Name, "dependencies"}, "/"),
+				strings.Join([]string{e.Config.Module, e.Config.Service.Name, logical.Name, "server"}, "/"),
+			},
+		},
+		&rs,
+	})
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	return nil
+}
+
+// interfacePrefix returns the prefix of the generated names of the nth API interface. The first interface is the
+// logical's API and keeps the unprefixed names.
+func interfacePrefix(n int, name string) string {
+	if n == 0 {
+		return ""
+	}
+
+	return name
+}
+
+// apiInputs returns the API file of the logical and the other files its API depends on.
+func apiInputs(e *Env, logical config.Logical) ([]string, error) {
+	if logical.API.FileName == "" {
+		return nil, nil
+	}
+
+	files, err := APIFiles(e, logical)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{filepath.Join(e.logicalDir(logical), logical.API.FileName)}, files...), nil
+}
+
+// apiOutputs returns the generated file of every API interface of the logical in the directory below the
+// logical's.
+func apiOutputs(e *Env, logical config.Logical, dir, name string) ([]string, error) {
+	if logical.API.FileName == "" {
+		return nil, nil
+	}
+
+	names, err := APIInterfaces(logical)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{filepath.Join(e.logicalDir(logical), dir, generatedFileName("", name))}
+	for i := 1; i < len(names); i++ {
+		files = append(files, filepath.Join(e.logicalDir(logical), dir, generatedFileName(names[i], name)))
+	}
+
+	return files, nil
+}
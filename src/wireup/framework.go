@@ -1,14 +1,10 @@
 package wireup
 
 import (
-	"os"
-	"os/exec"
-	"strings"
+	"path/filepath"
 
 	"github.com/luno/jettison/errors"
 
-	"gomicro/config"
-	"gomicro/ioeasy"
 	"gomicro/templates"
 )
 // {{physical service}}
@@ -31,16 +27,19 @@ import (
 //			+--> api.go
 
 // CreateFrameworkWithFillInStrategy takes the approach that if the file exists it will not touch that file
-// If the file does not exist then it will create it to ensure the project has all the required directories and files
-func FrameworkWithFillInStrategy(c *config.Config) error {
+// If the file does not exist then it will create it to ensure the project in the output tree has all the required directories and files
+func FrameworkWithFillInStrategy(e *Env) error {
+	c, root := e.Config, e.Root
+	serviceDir := filepath.Join(root, c.Service.Name)
+
 	// 3. Create physical service if it doesnt exist
-	err := ioeasy.CreateDirIfNotExists(c.Service.Name)
+	err := e.Output.CreateDirIfNotExists(serviceDir)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
 	// 4. Ensure physical service has a main.go file
-	err = ioeasy.CreateFileIfNotExists( c.Service.Name + "/main.go", templates.FileConfig{
+	err = e.Output.CreateFileIfNotExists(filepath.Join(serviceDir, "main.go"), templates.FileConfig{
 		&templates.PackageHeader{Name: "main"},
 		&templates.Function{Name: "main"},
 	})
@@ -48,40 +47,27 @@ func FrameworkWithFillInStrategy(c *config.Config) error {
 		return errors.Wrap(err, "")
 	}
 
-	// 5. Create a module file if does not exist and call go mod tidy
+	// 5. Create a module file if does not exist, which is tidied by ModTidy once the generated code is written
 	if c.Module != "" {
-		exists, err := ioeasy.FileExists("go.mod")
+		exists, err := e.Output.FileExists(filepath.Join(root, "go.mod"))
 		if err != nil {
 			return errors.Wrap(err, "")
 		}
 
 		if !exists {
-			init := []string{"mod", "init", c.Module}
-			cmd := exec.Command("go", init...)
-			_, err := cmd.Output()
+			err := e.Output.Run(root, "go", "mod", "init", c.Module)
 			if err != nil {
 				return errors.Wrap(err, "")
 			}
 		}
-
-		tidy := []string{"mod", "tidy"}
-		cmd := exec.Command("go", tidy...)
-		_, err = cmd.Output()
-		if err != nil {
-			return errors.Wrap(err, "failed run `go mod tidy`")
-		}
-	}
-
-	// Change to the physicals directory
-	err = os.Chdir(c.Service.Name)
-	if err != nil {
-		return errors.Wrap(err, "")
 	}
 
 	// 6. Build out each logical
 	for _, logical := range c.Service.Logicals {
+		dir := e.logicalDir(logical)
+
 		// 6.1 Ensure all logicals exist or are created
-		err = ioeasy.CreateDirIfNotExists(logical.Name)
+		err = e.Output.CreateDirIfNotExists(dir)
 		if err != nil {
 			return errors.Wrap(err, "")
 		}
@@ -101,8 +87,8 @@ func FrameworkWithFillInStrategy(c *config.Config) error {
 		}
 
 		// Ensure a basic example api is built for WireUp
-		apiFilePath := logical.Name + "/" + logical.API.FileName
-		err = ioeasy.CreateFileIfNotExists(apiFilePath, templates.FileConfig{
+		apiFilePath := filepath.Join(dir, logical.API.FileName)
+		err = e.Output.CreateFileIfNotExists(apiFilePath, templates.FileConfig{
 			&templates.PackageHeader{Name: logical.Name},
 			&templates.Imports{Values: []string{"context"}},
 			&templates.Interface{Name: logical.API.InterfaceName, Functions: []string{
@@ -114,63 +100,24 @@ func FrameworkWithFillInStrategy(c *config.Config) error {
 		}
 	}
 
-	err = os.Chdir("..")
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
-
 	return nil
 }
 
-func LogicalRuntimeSetup(c *config.Config) error {
-	err := os.Chdir(c.Service.Name)
-	if err != nil {
-		return errors.Wrap(err, "")
+// ModTidy runs go mod tidy in the output tree so that the module requires what the generated code imports
+func ModTidy(e *Env) error {
+	if e.Config.Module == "" {
+		return nil
 	}
 
-	for _, log := range c.Service.Logicals {
-		fileName := log.Name + "/" + log.Name + ".go"
-		err = ioeasy.CreateFileIfNotExists(fileName, nil)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		// Reset file
-		err := os.Truncate(fileName, 0)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		ph := templates.PackageHeader{
-			Name: log.Name,
-		}
-		err = ph.AddTo(f)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		imp := templates.Imports{
-			Values: []string{
-				strings.Join([]string{c.Module, c.Service.Name, log.Name, "dependencies"}, "/"),
-				strings.Join([]string{c.Module, c.Service.Name, log.Name, "server"}, "/"),
-			},
-		}
-		err = imp.AddTo(f)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		rs := templates.RuntimeSetup{}
-		err = rs.AddTo(f)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
+	err := e.Output.Run(e.Root, "go", "mod", "tidy")
+	if err != nil {
+		return errors.Wrap(err, "failed run `go mod tidy`")
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// LogicalRuntimeSetup generates the Run function of every logical in the output tree
+func LogicalRuntimeSetup(e *Env) error {
+	return runGenerators(e, GeneratorRuntime)
+}
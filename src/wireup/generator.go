@@ -0,0 +1,361 @@
+package wireup
+
+import (
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"gomicro/config"
+	"gomicro/ioeasy"
+	"gomicro/lint"
+	"gomicro/reader"
+)
+
+// ErrUnknownGenerator is returned when a logical selects a generator that is not registered.
+var ErrUnknownGenerator = errors.New("unknown generator", errors.WithoutStackTrace())
+
+// ErrDuplicateGenerator is returned when a generator is registered under a name that is taken.
+var ErrDuplicateGenerator = errors.New("generator already registered", errors.WithoutStackTrace())
+
+// ErrLogicals is returned when more than one logical fails to generate, listing the error of every one of them.
+var ErrLogicals = errors.New("logicals failed to generate", errors.WithoutStackTrace())
+
+// Env is what a generation runs in: the config and output tree it generates, the output its changes go to and the
+// loader its API packages are read with. Generations share nothing but the registry of generators so that they
+// can run at once, such as from tests.
+type Env struct {
+	Config *config.Config
+	// Root is the absolute path of the output tree
+	Root string
+	// Output receives the files written and the commands run
+	Output *ioeasy.Output
+	// Loader reads the API packages, seeing the files staged by the stages that ran before
+	Loader *reader.Loader
+	// Parallelism bounds the number of logicals that are generated at once, which is the number of CPUs when not
+	// positive
+	Parallelism int
+
+	// apis is shared by copies of the env, such as those of the stages of a generation, so that every API is read
+	// once per generation
+	apis *apiCache
+}
+
+// NewEnv returns the env that generates the config in the output tree at root, reading the API packages from
+// disk, with every change going to the output.
+func NewEnv(c *config.Config, root string, out *ioeasy.Output) *Env {
+	return &Env{
+		Config: c,
+		Root:   root,
+		Output: out,
+		Loader: reader.NewLoader(),
+		apis:   &apiCache{apis: make(map[string]*loadedAPI)},
+	}
+}
+
+// Generator generates code for a logical. The built-in generators are registered under their names and in-house
+// generators are added with Register, from a program that generates with the generate package, and selected per
+// logical in the config.
+type Generator interface {
+	// Name is what the generator is registered and selected by
+	Name() string
+	// Inputs returns the absolute paths of the files the generator reads for the logical, which decide whether
+	// the logical is generated again
+	Inputs(e *Env, logical config.Logical) ([]string, error)
+	// Outputs returns the absolute paths of the generated files the generator writes for the logical
+	Outputs(e *Env, logical config.Logical) ([]string, error)
+	// Run generates the code of the logical in the output tree of the env. Files are written with the output of
+	// the env so that they are staged, stamped and protected like those of the built-in generators.
+	Run(e *Env, logical config.Logical) error
+}
+
+// Names of the built-in generators.
+const (
+	GeneratorHTTPServer    = "httpserver"
+	GeneratorHTTPClient    = "httpclient"
+	GeneratorLogicalClient = "logicalclient"
+	GeneratorDependencies  = "dependencies"
+	GeneratorRuntime       = "runtime"
+)
+
+// builtins are the built-in generators in the order they run for every logical.
+var builtins = []string{
+	GeneratorHTTPServer,
+	GeneratorHTTPClient,
+	GeneratorLogicalClient,
+	GeneratorDependencies,
+	GeneratorRuntime,
+}
+
+var generators = make(map[string]Generator)
+
+func init() {
+	for _, g := range []Generator{httpServer{}, httpClient{}, logicalClient{}, dependencies{}, runtimeSetup{}} {
+		err := Register(g)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds the generator to the registry so that logicals can select it by name.
+func Register(g Generator) error {
+	if _, ok := generators[g.Name()]; ok {
+		return errors.Wrap(ErrDuplicateGenerator, "", j.KV("generator", g.Name()))
+	}
+
+	generators[g.Name()] = g
+	return nil
+}
+
+// Lookup returns the generator registered under the name.
+func Lookup(name string) (Generator, bool) {
+	g, ok := generators[name]
+	return g, ok
+}
+
+// GeneratorNames returns the name of every registered generator in order.
+func GeneratorNames() []string {
+	var names []string
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Selected returns the generators that run for the logical in order, being the built-in generators followed by
+// those the logical selects in the config.
+func Selected(logical config.Logical) ([]Generator, error) {
+	var gs []Generator
+	for _, name := range append(append([]string(nil), builtins...), logical.Generators...) {
+		g, ok := Lookup(name)
+		if !ok {
+			return nil, errors.Wrap(ErrUnknownGenerator, "", j.MKV{
+				"logical":    logical.Name,
+				"generator":  name,
+				"registered": strings.Join(GeneratorNames(), ", "),
+			})
+		}
+
+		gs = append(gs, g)
+	}
+
+	return gs, nil
+}
+
+// Inputs returns the files that the generators of the logical read in order.
+func Inputs(e *Env, logical config.Logical) ([]string, error) {
+	return collect(e, logical, Generator.Inputs)
+}
+
+// Outputs returns the generated files that the generators of the logical write in order.
+func Outputs(e *Env, logical config.Logical) ([]string, error) {
+	return collect(e, logical, Generator.Outputs)
+}
+
+func collect(e *Env, logical config.Logical,
+	files func(Generator, *Env, config.Logical) ([]string, error)) ([]string, error) {
+
+	gs, err := Selected(logical)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, g := range gs {
+		fs, err := files(g, e, logical)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KV("generator", g.Name()))
+		}
+
+		for _, path := range fs {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// Plugins runs the generators that every logical selects in the config on the output tree.
+func Plugins(e *Env) error {
+	return forEachLogical(e, func(logical config.Logical) error {
+		for _, name := range logical.Generators {
+			err := runGenerator(e, logical, name)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// runGenerators runs the named built-in generators for every logical on the output tree.
+func runGenerators(e *Env, names ...string) error {
+	return forEachLogical(e, func(logical config.Logical) error {
+		for _, name := range names {
+			err := runGenerator(e, logical, name)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// forEachLogical calls fn for every logical of the config in parallel, bounded by the parallelism of the env. Every
+// logical is generated even when others fail and the errors are returned in the order of the config.
+func forEachLogical(e *Env, fn func(logical config.Logical) error) error {
+	c := e.Config
+	n := e.Parallelism
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+
+	errs := make([]error, len(c.Service.Logicals))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i, logical := range c.Service.Logicals {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, logical config.Logical) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			errs[i] = fn(logical)
+		}(i, logical)
+	}
+	wg.Wait()
+
+	var failed []string
+	var first error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if first == nil {
+			first = err
+		}
+		failed = append(failed, c.Service.Logicals[i].Name+": "+err.Error())
+	}
+
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return first
+	}
+
+	return errors.Wrap(ErrLogicals, "", j.MKV{"failed": len(failed), "errors": strings.Join(failed, "; ")})
+}
+
+func runGenerator(e *Env, logical config.Logical, name string) error {
+	g, ok := Lookup(name)
+	if !ok {
+		return errors.Wrap(ErrUnknownGenerator, "", j.MKV{
+			"logical":    logical.Name,
+			"generator":  name,
+			"registered": strings.Join(GeneratorNames(), ", "),
+		})
+	}
+
+	err := g.Run(e, logical)
+	if err != nil {
+		return errors.Wrap(err, "", j.MKV{"logical": logical.Name, "generator": name})
+	}
+
+	return nil
+}
+
+// loadedAPI is the API of a logical along with the routes of its methods.
+type loadedAPI struct {
+	api    *reader.API
+	routes map[string]map[string]Route
+}
+
+// apiCache caches the APIs loaded, keyed by the path of the API file, so that the generators of a logical and the
+// manifest read it once. API files are written by hand, or created by the framework stage before any API is read,
+// so an API never changes while the generation runs. A nil cache caches nothing.
+type apiCache struct {
+	mu   sync.Mutex
+	apis map[string]*loadedAPI
+}
+
+func (a *apiCache) get(path string) (*loadedAPI, bool) {
+	if a == nil {
+		return nil, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	l, ok := a.apis[path]
+	return l, ok
+}
+
+func (a *apiCache) put(path string, l *loadedAPI) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.apis[path] = l
+}
+
+// LoadAPI reads the API of the logical, refusing APIs that would result in transports that do not compile, and
+// resolves the routes of its methods. It returns nil when the logical has no API file.
+func LoadAPI(e *Env, logical config.Logical) (*reader.API, map[string]map[string]Route, error) {
+	if logical.API.FileName == "" {
+		return nil, nil, nil
+	}
+
+	dir := e.logicalDir(logical)
+	path := filepath.Join(dir, logical.API.FileName)
+	// Logicals are generated in parallel but each reads its own API so it is never read twice at once
+	if a, ok := e.apis.get(path); ok {
+		return a.api, a.routes, nil
+	}
+
+	names, err := APIInterfaces(logical)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	api, err := e.Loader.ReadAPI(logical.Name, path, names...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Refuse to generate transports that would not compile
+	err = lint.Error(lint.Check(api))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "", j.KV("logical", logical.Name))
+	}
+
+	routes, err := HTTPRoutes(logical, dir, api)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e.apis.put(path, &loadedAPI{api: api, routes: routes})
+
+	return api, routes, nil
+}
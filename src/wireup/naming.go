@@ -0,0 +1,184 @@
+package wireup
+
+import (
+	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gomicro/reader"
+)
+
+// variable is a parameter or result of an API method with the names it is given in generated code.
+type variable struct {
+	reader.Variable
+
+	// Local is the identifier of the variable in generated functions. It is unique within the method and does not
+	// shadow the packages or the locals that generated functions refer to.
+	Local string
+	// Field is the name of the variable's field in the request or response type which is unique within the type
+	Field string
+	// FieldType is the type of the field which is a slice for variadic parameters
+	FieldType string
+
+	Variadic bool
+	// Error is true for the last result when it is an error, which is not sent as a field of the response
+	Error bool
+}
+
+// Arg returns the expression that passes the value of the variable named by expr as an argument.
+func (v variable) Arg(expr string) string {
+	if v.Variadic {
+		return expr + "..."
+	}
+
+	return expr
+}
+
+// generatedLocals are the identifiers declared by the generated handlers and clients
+var generatedLocals = []string{
+	"api", "b", "c", "cl", "ctx", "err", "httpReq", "httpResp", "query", "r", "req", "resp", "respBody", "s",
+	"uniquePath", "v", "w",
+}
+
+// generatedPackages are the names of the packages that generated handlers and clients refer to
+var generatedPackages = []string{
+	"bytes", "context", "ctxhttp", "fmt", "http", "ioutil", "json", "server", "strconv", "url",
+}
+
+var qualifiedIdent = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.`)
+
+// nameVariables returns the parameters, without the context, and the results of the method with deterministic
+// names. Named variables keep their names unless they are taken while unnamed variables are named after their
+// type, with a numeric suffix added to resolve collisions.
+func nameVariables(logical string, method reader.FunctionSignature) (params []variable, results []variable) {
+	for i, v := range method.Params {
+		// The context is passed on by the generated functions rather than sent, whatever its import name
+		if i == 0 && reader.IsContext(v.Type) {
+			continue
+		}
+
+		params = append(params, variable{
+			Variable:  v,
+			FieldType: v.ImportType,
+			Variadic:  strings.HasPrefix(v.ImportType, "..."),
+		})
+	}
+
+	for i, v := range method.Results {
+		results = append(results, variable{
+			Variable:  v,
+			FieldType: v.ImportType,
+			Error:     i == len(method.Results)-1 && v.ImportType == "error",
+		})
+	}
+
+	locals := newNamer()
+	locals.reserve(generatedLocals...)
+	locals.reserve(generatedPackages...)
+	locals.reserve(logical)
+	locals.reserve(types.Universe.Names()...)
+
+	all := append(append([]*variable(nil), pointers(params)...), pointers(results)...)
+	for _, v := range all {
+		for _, m := range qualifiedIdent.FindAllStringSubmatch(v.ImportType, -1) {
+			locals.reserve(m[1])
+		}
+
+		if v.Variadic {
+			v.FieldType = "[]" + strings.TrimPrefix(v.ImportType, "...")
+		}
+	}
+
+	// The error is always returned as err by the generated functions
+	for _, v := range all {
+		if v.Error {
+			v.Local = "err"
+		}
+	}
+
+	// Named variables take precedence so that they keep their names where possible
+	for _, named := range []bool{true, false} {
+		for _, v := range all {
+			if v.Error || (v.Name != "") != named {
+				continue
+			}
+
+			v.Local = locals.name(baseName(*v))
+		}
+	}
+
+	for _, vs := range [][]variable{params, results} {
+		fields := newNamer()
+		for _, named := range []bool{true, false} {
+			for i := range vs {
+				if vs[i].Error || (vs[i].Name != "") != named {
+					continue
+				}
+
+				vs[i].Field = fields.name(ExportiseName(baseName(vs[i])))
+			}
+		}
+	}
+
+	return params, results
+}
+
+func pointers(vs []variable) []*variable {
+	var ps []*variable
+	for i := range vs {
+		ps = append(ps, &vs[i])
+	}
+
+	return ps
+}
+
+// baseName returns the name of the variable or a name derived from its type when it is unnamed.
+func baseName(v variable) string {
+	if v.Name != "" && v.Name != "_" {
+		return v.Name
+	}
+
+	return typeName(v.Type)
+}
+
+// typeName returns an identifier describing the type such as user for users.User and userList for []users.User.
+func typeName(typ types.Type) string {
+	switch t := types.Unalias(typ).(type) {
+	case *types.Pointer:
+		return typeName(t.Elem())
+	case *types.Slice:
+		return typeName(t.Elem()) + "List"
+	case *types.Array:
+		return typeName(t.Elem()) + "List"
+	case *types.Map:
+		return typeName(t.Elem()) + "Map"
+	case *types.Named:
+		return reader.LowerInitialism(t.Obj().Name())
+	default:
+		return "value"
+	}
+}
+
+// namer hands out unique identifiers by suffixing a number to names that are taken.
+type namer map[string]bool
+
+func newNamer() namer {
+	return make(namer)
+}
+
+func (n namer) reserve(names ...string) {
+	for _, name := range names {
+		n[name] = true
+	}
+}
+
+func (n namer) name(base string) string {
+	name := base
+	for i := 2; n[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+
+	n[name] = true
+	return name
+}
@@ -0,0 +1,143 @@
+package wireup
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gomicro/reader"
+)
+
+func TestNameVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		params  []string
+		results []string
+	}{
+		{
+			name:    "named",
+			method:  "Get(ctx context.Context, id string, limit int) (user User, err error)",
+			params:  []string{"id Id string", "limit Limit int"},
+			results: []string{"user User users.User", "err  error"},
+		},
+		{
+			name:    "context under another name",
+			method:  "Get(c gocontext.Context, id string) error",
+			params:  []string{"id Id string"},
+			results: []string{"err  error"},
+		},
+		{
+			name:    "unnamed",
+			method:  "Get(context.Context, string, *User, []User, map[string]User) (User, int, error)",
+			params:  []string{"value Value string", "user User *users.User", "userList UserList []users.User", "userMap UserMap map[string]users.User"},
+			results: []string{"user2 User users.User", "value2 Value int", "err  error"},
+		},
+		{
+			name:    "unnamed after named",
+			method:  "Get(ctx context.Context, user User, _ User) error",
+			params:  []string{"user User users.User", "user2 User2 users.User"},
+			results: []string{"err  error"},
+		},
+		{
+			name:    "generated locals and packages",
+			method:  "Get(ctx context.Context, req string, http int, users string, resp bool) error",
+			params:  []string{"req2 Req string", "http2 Http int", "users2 Users string", "resp2 Resp bool"},
+			results: []string{"err  error"},
+		},
+		{
+			name:    "qualifiers",
+			method:  "Get(ctx context.Context, time time.Time) error",
+			params:  []string{"time2 Time time.Time"},
+			results: []string{"err  error"},
+		},
+		{
+			name:    "initialisms",
+			method:  "Get(context.Context, ID, URL) error",
+			params:  []string{"id Id users.ID", "url2 Url users.URL"},
+			results: []string{"err  error"},
+		},
+		{
+			name:    "variadic",
+			method:  "Get(ctx context.Context, ids ...string) error",
+			params:  []string{"ids Ids []string"},
+			results: []string{"err  error"},
+		},
+		{
+			name:    "error not last",
+			method:  "Get(ctx context.Context) (error, int)",
+			results: []string{"error2 Error error", "value Value int"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method := readMethod(t, test.method)
+
+			ps, rs := nameVariables("users", method)
+			if got := describe(ps); !reflect.DeepEqual(got, test.params) {
+				t.Errorf("params %q, want %q", got, test.params)
+			}
+
+			if got := describe(rs); !reflect.DeepEqual(got, test.results) {
+				t.Errorf("results %q, want %q", got, test.results)
+			}
+		})
+	}
+}
+
+// readMethod reads the method from an API of the users logical.
+func readMethod(t *testing.T, method string) reader.FunctionSignature {
+	t.Helper()
+
+	dir := t.TempDir()
+	src := `package users
+
+import (
+	"context"
+	gocontext "context"
+	"time"
+)
+
+var (
+	_ context.Context
+	_ gocontext.Context
+	_ time.Time
+)
+
+type API interface {
+	` + method + `
+}
+
+type User struct{}
+
+type ID string
+
+type URL string
+`
+
+	for name, b := range map[string]string{"go.mod": "module example\n\ngo 1.23\n", "api.go": src} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(b), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	api, err := reader.NewLoader().ReadAPI("users", filepath.Join(dir, "api.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api.Interfaces[0].Methods[0]
+}
+
+// describe returns the local, field and field type of every variable.
+func describe(vs []variable) []string {
+	var ds []string
+	for _, v := range vs {
+		ds = append(ds, v.Local+" "+v.Field+" "+v.FieldType)
+	}
+
+	return ds
+}
@@ -0,0 +1,273 @@
+package wireup
+
+import (
+	"go/types"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+
+	"gomicro/config"
+	"gomicro/reader"
+	"gomicro/templates"
+)
+
+// ErrGoVersion is returned when http directives are used by a module whose go version predates method and
+// wildcard patterns in net/http.
+var ErrGoVersion = errors.New("http directives require go 1.22 or later in go.mod", errors.WithoutStackTrace())
+
+// ErrDuplicateRoute is returned when two methods of a logical are served on the same route.
+var ErrDuplicateRoute = errors.New("duplicate http route", errors.WithoutStackTrace())
+
+// Route is how a method is served over http which is shared by the server and the http client. Methods without
+// an http directive are served by POST on a path derived from the logical and method names.
+type Route struct {
+	reader.HTTPRoute
+
+	// Pattern is what the handler is registered with on the http.ServeMux
+	Pattern string
+}
+
+// HTTPRoutes returns the routes of every method of the API keyed by interface and method name. Verbs are part of
+// the registered patterns when the go version of the module containing the logical's dir supports them, which
+// http directives depend on.
+func HTTPRoutes(logical config.Logical, dir string, api *reader.API) (map[string]map[string]Route, error) {
+	methodPatterns, err := supportsMethodPatterns(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string]map[string]Route)
+	registered := make(map[string]string)
+	for i, it := range api.Interfaces {
+		var prefix string
+		if i > 0 {
+			prefix = it.Name
+		}
+
+		routes[it.Name] = make(map[string]Route)
+		for _, method := range it.Methods {
+			route := Route{HTTPRoute: reader.HTTPRoute{
+				Verb:   http.MethodPost,
+				Path:   "/" + handlerURI(logical, prefix, method.Name),
+				Status: http.StatusOK,
+			}}
+
+			if method.HTTP != nil {
+				if !methodPatterns {
+					return nil, errors.Wrap(ErrGoVersion, "", j.MKV{
+						"logical":  logical.Name,
+						"position": method.HTTP.Pos.String(),
+					})
+				}
+
+				route = Route{HTTPRoute: *method.HTTP}
+			}
+
+			route.Pattern = route.Path
+			if methodPatterns {
+				route.Pattern = route.Verb + " " + route.Path
+			}
+
+			// Patterns that only differ by the names of their wildcards match the same requests
+			key := wildcard.ReplaceAllString(route.Pattern, "{}")
+			if prev, ok := registered[key]; ok {
+				return nil, errors.Wrap(ErrDuplicateRoute, "", j.MKV{
+					"route":  route.Pattern,
+					"first":  prev,
+					"second": it.Name + "." + method.Name,
+				})
+			}
+			registered[key] = it.Name + "." + method.Name
+
+			routes[it.Name][method.Name] = route
+		}
+	}
+
+	return routes, nil
+}
+
+var wildcard = regexp.MustCompile(`\{[^}]*\}`)
+
+var goDirective = regexp.MustCompile(`(?m)^go\s+1\.(\d+)`)
+
+// supportsMethodPatterns returns true if the go.mod closest to dir declares a go version of at least 1.22 from
+// which http.ServeMux matches patterns with verbs and wildcards.
+func supportsMethodPatterns(dir string) (bool, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false, errors.Wrap(err, "")
+	}
+
+	for d := abs; ; d = filepath.Dir(d) {
+		b, err := ioutil.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			m := goDirective.FindSubmatch(b)
+			if m == nil {
+				return false, nil
+			}
+
+			minor, err := strconv.Atoi(string(m[1]))
+			if err != nil {
+				return false, errors.Wrap(err, "")
+			}
+
+			return minor >= 22, nil
+		}
+
+		if filepath.Dir(d) == d {
+			return false, nil
+		}
+	}
+}
+
+var statusNames = map[int]string{
+	http.StatusOK:                   "http.StatusOK",
+	http.StatusCreated:              "http.StatusCreated",
+	http.StatusAccepted:             "http.StatusAccepted",
+	http.StatusNonAuthoritativeInfo: "http.StatusNonAuthoritativeInfo",
+	http.StatusNoContent:            "http.StatusNoContent",
+	http.StatusResetContent:         "http.StatusResetContent",
+	http.StatusPartialContent:       "http.StatusPartialContent",
+}
+
+// statusCode returns the net/http constant for the status code or the code itself when there is none.
+func statusCode(code int) string {
+	if name, ok := statusNames[code]; ok {
+		return name
+	}
+
+	return strconv.Itoa(code)
+}
+
+// bindings returns how the server sets the request fields of the parameters bound to the path and query.
+func bindings(route Route, params map[string]variable) []templates.Binding {
+	var bs []templates.Binding
+	for _, name := range route.PathParams {
+		bs = append(bs, binding(params[name], `r.PathValue("`+name+`")`))
+	}
+
+	for _, name := range route.QueryParams {
+		bs = append(bs, binding(params[name], `r.URL.Query().Get("`+name+`")`))
+	}
+
+	return bs
+}
+
+// binding returns the statements that parse the text s of a parameter into the value v.
+func binding(v variable, source string) templates.Binding {
+	b := templates.Binding{
+		Field:  v.Field,
+		Source: source,
+	}
+
+	basic := v.Type.Underlying().(*types.Basic)
+	switch {
+	case basic.Info()&types.IsString != 0:
+		b.Value = convert(v, "string", "s")
+	case basic.Info()&types.IsBoolean != 0:
+		b.Parse = "strconv.ParseBool(s)"
+		b.Value = convert(v, "bool", "v")
+	case basic.Info()&types.IsUnsigned != 0:
+		b.Parse = "strconv.ParseUint(s, 10, " + bitSize(basic) + ")"
+		b.Value = convert(v, "uint64", "v")
+	case basic.Info()&types.IsInteger != 0:
+		b.Parse = "strconv.ParseInt(s, 10, " + bitSize(basic) + ")"
+		b.Value = convert(v, "int64", "v")
+	case basic.Info()&types.IsFloat != 0:
+		b.Parse = "strconv.ParseFloat(s, " + bitSize(basic) + ")"
+		b.Value = convert(v, "float64", "v")
+	}
+
+	return b
+}
+
+// format returns the expression that formats the parameter as text for its path or query parameter.
+func format(v variable) string {
+	basic := v.Type.Underlying().(*types.Basic)
+	switch {
+	case basic.Info()&types.IsBoolean != 0:
+		return "strconv.FormatBool(" + convertTo(v, "bool") + ")"
+	case basic.Info()&types.IsUnsigned != 0:
+		return "strconv.FormatUint(" + convertTo(v, "uint64") + ", 10)"
+	case basic.Info()&types.IsInteger != 0:
+		return "strconv.FormatInt(" + convertTo(v, "int64") + ", 10)"
+	case basic.Info()&types.IsFloat != 0:
+		return "strconv.FormatFloat(" + convertTo(v, "float64") + ", 'g', -1, " + bitSize(basic) + ")"
+	default:
+		return convertTo(v, "string")
+	}
+}
+
+// pathExpression returns the expression that builds the path of a request from the path template and the
+// method's parameters.
+func pathExpression(route Route, params map[string]variable) string {
+	var (
+		parts   []string
+		literal string
+	)
+	for i, segment := range strings.Split(route.Path, "/") {
+		if i > 0 {
+			literal += "/"
+		}
+
+		m := wildcard.FindString(segment)
+		if m == "" {
+			literal += segment
+			continue
+		}
+
+		if literal != "" {
+			parts = append(parts, strconv.Quote(literal))
+			literal = ""
+		}
+
+		parts = append(parts, "url.PathEscape("+format(params[m[1:len(m)-1]])+")")
+	}
+
+	if literal != "" {
+		parts = append(parts, strconv.Quote(literal))
+	}
+
+	return strings.Join(parts, " + ")
+}
+
+// convert returns the expression converting the variable called name, of the type from produced by strconv, to
+// the parameter's type.
+func convert(v variable, from, name string) string {
+	if v.ImportType == from {
+		return name
+	}
+
+	return v.ImportType + "(" + name + ")"
+}
+
+// convertTo returns the expression converting the parameter to the type accepted by strconv.
+func convertTo(v variable, to string) string {
+	if v.ImportType == to {
+		return v.Local
+	}
+
+	return to + "(" + v.Local + ")"
+}
+
+func bitSize(basic *types.Basic) string {
+	switch basic.Kind() {
+	case types.Int8, types.Uint8:
+		return "8"
+	case types.Int16, types.Uint16:
+		return "16"
+	case types.Int32, types.Uint32, types.Float32:
+		return "32"
+	case types.Int64, types.Uint64, types.Float64:
+		return "64"
+	default:
+		// The size of int, uint and uintptr
+		return "0"
+	}
+}
@@ -1,148 +1,132 @@
 package wireup
 
 import (
+	"go/build"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 
 	"gomicro/config"
-	"gomicro/ioeasy"
 	"gomicro/reader"
 	"gomicro/templates"
 )
 
-// WireUpDependencies attempts to setup and inject inter-service dependencies
-func Dependencies(c *config.Config) error {
-	err := os.Chdir(c.Service.Name)
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
-
-	for _, log := range c.Service.Logicals {
-		// 6.2 Ensure that dependencies are built out
-		err = ioeasy.CreateDirIfNotExists(log.Name + "/" + "dependencies")
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		fileName := log.Name + "/dependencies/dependencies.go"
-		err = ioeasy.CreateFileIfNotExists(fileName, nil)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
+// ErrInterfaceRequired is returned when additional interfaces are configured without the logical's API interface.
+var ErrInterfaceRequired = errors.New("api interface must be configured with additional interfaces", errors.WithoutStackTrace())
 
-		// Reset file
-		err := os.Truncate(fileName, 0)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		serverFile, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		var deps []templates.Dependency
-		var imports []string
-		for _, d := range log.Dependencies {
-			deps = append(deps, templates.Dependency{
-				GetterName:   d.Name,
-				VariableName: strings.ToLower(d.Name),
-				ImportedType: d.Type,
-			})
+// WireUpDependencies attempts to setup and inject inter-service dependencies into the output tree
+func Dependencies(e *Env) error {
+	return runGenerators(e, GeneratorDependencies)
+}
 
-			imports = append(imports, d.Path)
-		}
+// WireUpHttpClientServer takes an interface as an http API and generates a connected http client and server in
+// the output tree, along with the logical client
+func HttpClientServer(e *Env) error {
+	return runGenerators(e, GeneratorHTTPServer, GeneratorHTTPClient, GeneratorLogicalClient)
+}
 
-		p := templates.PackageHeader{Name: "dependencies"}
-		err = p.AddTo(serverFile)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
+// logicalDir returns the directory of the logical in the output tree.
+func (e *Env) logicalDir(logical config.Logical) string {
+	return filepath.Join(e.Root, e.Config.Service.Name, logical.Name)
+}
 
-		imps := templates.Imports{Values: imports}
-		err = imps.AddTo(serverFile)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
+// APIFiles returns the files other than the API file that the logical's API depends on in order, being those that
+// declare the types sent over the wire or the interfaces it embeds and those of the packages of the module that the
+// API file imports. The generated code depends on them along with the API package.
+func APIFiles(e *Env, logical config.Logical) ([]string, error) {
+	api, _, err := LoadAPI(e, logical)
+	if err != nil || api == nil {
+		return nil, err
+	}
 
-		dt := templates.DependencyTemplate{
-			Deps: deps,
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if path == "" || seen[path] {
+			return
 		}
 
-		err = dt.AddTo(serverFile)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
+		seen[path] = true
+		files = append(files, path)
 	}
 
-	err = os.Chdir("..")
-	if err != nil {
-		return errors.Wrap(err, "")
+	for _, t := range api.Types {
+		add(t.Pos.Filename)
 	}
 
-	return nil
-}
+	for _, pos := range api.Embeds {
+		add(pos.Filename)
+	}
 
-// WireUpHttpClientServer takes an interface as an http API and generates a connected http client and server
-func HttpClientServer(c *config.Config) error {
-	err := os.Chdir(c.Service.Name)
-	if err != nil {
-		return errors.Wrap(err, "")
+	// Methods of embedded interfaces are declared in the files of those interfaces
+	for _, it := range api.Interfaces {
+		for _, m := range it.Methods {
+			add(m.Pos.Filename)
+		}
 	}
 
-	for _, logical := range c.Service.Logicals {
-		if logical.API.FileName == "" {
+	for _, imp := range api.Imports {
+		if e.Config.Module == "" || !strings.HasPrefix(imp.Path, e.Config.Module+"/") {
 			continue
 		}
 
-		path := logical.Name + "/" + logical.API.FileName
-		fs, err := reader.ReadAPI(logical.Name, path)
+		dir := filepath.Join(e.Root, filepath.FromSlash(strings.TrimPrefix(imp.Path, e.Config.Module+"/")))
+		bp, err := build.ImportDir(dir, 0)
 		if err != nil {
-			return errors.Wrap(err, "")
+			return nil, errors.Wrap(err, "", j.MKV{"logical": logical.Name, "import": imp.Path})
 		}
 
-		err = CreateServerImpl(c, logical, fs)
-		if err != nil {
-			return errors.Wrap(err, "")
+		for _, name := range bp.GoFiles {
+			add(filepath.Join(dir, name))
 		}
+	}
+	sort.Strings(files)
 
-		err = CreateHttpClientImpl(c, logical, fs)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
+	return files, nil
+}
 
-		err = CreateLogicalClientImpl(c, logical, fs)
-		if err != nil {
-			return errors.Wrap(err, "")
+// APIInterfaces returns the names of the interfaces that transports are generated for with the logical's
+// API interface first. No names are returned when the interface is not configured so that the reader can
+// resolve it from the API file.
+func APIInterfaces(logical config.Logical) ([]string, error) {
+	if logical.API.InterfaceName == "" {
+		if len(logical.API.Interfaces) > 0 {
+			return nil, errors.Wrap(ErrInterfaceRequired, "", j.KV("logical", logical.Name))
 		}
-	}
 
-	err = os.Chdir("..")
-	if err != nil {
-		return errors.Wrap(err, "")
+		return nil, nil
 	}
 
-	return nil
-}
+	names := []string{logical.API.InterfaceName}
+	seen := map[string]bool{logical.API.InterfaceName: true}
+	for _, name := range logical.API.Interfaces {
+		if seen[name] {
+			continue
+		}
 
-func CreateServerImpl(c *config.Config, logical config.Logical, fs []reader.FunctionSignature) error {
-	err := ioeasy.CreateDirIfNotExists(logical.Name + "/server")
-	if err != nil {
-		return errors.Wrap(err, "")
+		seen[name] = true
+		names = append(names, name)
 	}
 
-	fileName := logical.Name + "/server/server_gen.go"
-	err = ioeasy.CreateFileIfNotExists(fileName, templates.FileConfig{
-		&templates.PackageHeader{Name: "server"},
-	})
+	return names, nil
+}
+
+// CreateServerType creates the user owned server file with the Server type that implements every API
+// interface of the logical. The file is never overwritten.
+func CreateServerType(e *Env, logical config.Logical, apis []reader.Interface) error {
+	c := e.Config
+	dir := filepath.Join(e.logicalDir(logical), "server")
+	err := e.Output.CreateDirIfNotExists(dir)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	fileName = logical.Name + "/server/server.go"
-	err = ioeasy.CreateFileIfNotExists(fileName, templates.FileConfig{
+	fc := templates.FileConfig{
 		&templates.Statement{Value: "// GoMicro expects a struct type called Server to exist and is dependant on it."},
 		&templates.Statement{Value: "// You may edit this file and will not be overwritten."},
 		&templates.PackageHeader{Name: "server"},
@@ -154,355 +138,421 @@ func CreateServerImpl(c *config.Config, logical config.Logical, fs []reader.Func
 		},
 		&templates.Struct{
 			Name: "Server",
-			Fields: map[string]string{
-				"Dependencies": "dependencies.Dependencies",
+			Fields: []templates.Field{
+				{Name: "Dependencies", Type: "dependencies.Dependencies"},
 			},
 		},
 		new(templates.Linebreak),
-		&templates.Statement{Value: "var _ " + logical.Name + "." + logical.API.InterfaceName + " = (*Server)(nil)"},
-	})
-	if err != nil {
-		return errors.Wrap(err, "")
 	}
 
-	serverFilePath := logical.Name + "/server/server_gen.go"
+	for _, api := range apis {
+		fc = append(fc, &templates.Statement{Value: "var _ " + logical.Name + "." + api.Name + " = (*Server)(nil)"})
+	}
 
-	// Reset server file
-	err = os.Truncate(serverFilePath, 0)
+	err = e.Output.CreateFileIfNotExists(filepath.Join(dir, "server.go"), fc)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	serverFile, err := os.OpenFile(serverFilePath, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-	if err != nil {
-		return errors.Wrap(err, "")
+	return nil
+}
+
+// imports collects the imports of a generated file keyed by path with the name the package is imported as,
+// which is empty when the package's own name is used.
+type imports map[string]string
+
+func (i imports) add(imps ...reader.Import) {
+	for _, imp := range imps {
+		i[imp.Path] = imp.Name
 	}
+}
 
-	packageHeader := templates.PackageHeader{
-		Name: "server",
+func (i imports) addPaths(paths ...string) {
+	for _, path := range paths {
+		i[path] = ""
 	}
+}
 
-	err = packageHeader.AddTo(serverFile)
-	if err != nil {
-		return errors.Wrap(err, "")
+// values returns the imports as templates.Imports values grouped into the standard library, other modules and
+// the packages of the module being generated, with each group sorted by path.
+func (i imports) values(module string) []string {
+	var std, other, local []string
+	for path := range i {
+		switch {
+		case isStandardLibrary(path):
+			std = append(std, path)
+		case path == module || strings.HasPrefix(path, module+"/"):
+			local = append(local, path)
+		default:
+			other = append(other, path)
+		}
 	}
 
-	// Add required imports to file
-	imps := templates.Imports{
-		Values: []string{
-			"encoding/json",
-			"io/ioutil",
-			"net/http",
-			templates.SingleLineSpace.String(),
-			c.Module + "/" + c.Service.Name + "/" + logical.Name,
-		},
+	var values []string
+	for _, group := range [][]string{std, other, local} {
+		if len(group) == 0 {
+			continue
+		}
+
+		sort.Strings(group)
+		if len(values) > 0 {
+			values = append(values, templates.SingleLineSpace.String())
+		}
+
+		for _, path := range group {
+			if name := i[path]; name != "" {
+				path = name + " " + path
+			}
+
+			values = append(values, path)
+		}
 	}
-	err = imps.AddTo(serverFile)
+
+	return values
+}
+
+// isStandardLibrary returns true for import paths of packages in GOROOT.
+func isStandardLibrary(path string) bool {
+	fi, err := os.Stat(filepath.Join(build.Default.GOROOT, "src", filepath.FromSlash(path)))
+	return err == nil && fi.IsDir()
+}
+
+// docComment joins a generated summary of a declaration with the doc comment it was derived from in the API.
+func docComment(summary, doc string) string {
+	if doc == "" {
+		return summary
+	}
+
+	return summary + "\n\n" + doc
+}
+
+// generatedFileName returns the name of a generated file which is prefixed when it belongs to one of the
+// logical's additional interfaces.
+func generatedFileName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return strings.ToLower(prefix) + "_" + name
+}
+
+// handlerURI returns the route of an API method which is shared by the server and the http client.
+func handlerURI(logical config.Logical, prefix, method string) string {
+	parts := []string{strings.ToLower(logical.Name)}
+	if prefix != "" {
+		parts = append(parts, strings.ToLower(prefix))
+	}
+
+	return strings.Join(append(parts, strings.ToLower(method)), "/")
+}
+
+func CreateServerImpl(e *Env, logical config.Logical, api reader.Interface, prefix string, types []reader.TypeDecl, routes map[string]Route) error {
+	c := e.Config
+	dir := filepath.Join(e.logicalDir(logical), "server")
+	err := e.Output.CreateDirIfNotExists(dir)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
+	// Add required imports to file along with the packages of the types sent over the wire. Decoding bodies and
+	// parsing bound parameters depend on the routes of the methods.
+	imps := make(imports)
+	imps.addPaths(
+		"net/http",
+		c.Module+"/"+c.Service.Name+"/"+logical.Name,
+	)
+
+	apiName := strings.Join([]string{logical.Name, api.Name}, ".")
 	htr := templates.HttpRegister{
-		API: strings.Join([]string{logical.Name, logical.API.InterfaceName}, "."),
+		Prefix: prefix,
+		API:    apiName,
+		Types:  types,
 	}
 
-	for _, method := range fs {
+	var body templates.FileConfig
+	for _, method := range api.Methods {
+		route := routes[method.Name]
 		htr.Handlers = append(htr.Handlers, templates.Handler{
-			URI: strings.Join([]string{strings.ToLower(logical.Name), strings.ToLower(method.Name)}, "/"),
-			Method: method.Name,
+			Pattern: route.Pattern,
+			Method:  method.Name,
 		})
 
+		params, results := nameVariables(logical.Name, method)
+
 		// Create request type
-		requestFields := make(map[string]string)
-		var params []string
-		for _, v := range method.Params {
-			if v.ImportType == "context.Context" {
-				continue
-			}
-			v.Name = ExportiseName(v.Name)
-			requestFields[v.Name] = v.ImportType
-			params = append(params, v.Name)
+		var requestFields []templates.Field
+		paramsByName := make(map[string]variable)
+		var args []string
+		for _, v := range params {
+			imps.add(v.Imports...)
+			paramsByName[v.Name] = v
+			requestFields = append(requestFields, templates.Field{Name: v.Field, Type: v.FieldType})
+			args = append(args, v.Arg("req."+v.Field))
 		}
 		req := templates.Struct{
-			Name:   method.Name + "Request",
+			Name:   prefix + method.Name + "Request",
+			Doc:    docComment(prefix+method.Name+"Request is the request body of "+apiName+"."+method.Name+".", method.Doc),
 			Fields: requestFields,
 		}
 
-		err = req.AddTo(serverFile)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
-		// Create response type
-		responseFields := make(map[string]string)
-		var responseParams []string
-		var results []string
-		for _, v := range method.Results {
-			// Do not include errors in the response type but do in the results
-			if v.ImportType == "error" {
-				results = append(results, "err")
+		// Create response type with a field for every result but the error
+		var responseFields []templates.Field
+		var response []templates.FieldValue
+		var locals []string
+		for _, v := range results {
+			imps.add(v.Imports...)
+			locals = append(locals, v.Local)
+			if v.Error {
 				continue
 			}
 
-			if v.Name == "" {
-				sp := strings.Split(v.ImportType, "")
-				if len(sp) > 2 {
-					sp = sp[:3]
-				} else if len(sp) == 2{
-					sp = sp[:2]
-				}
-
-				v.Name = strings.Join(sp, "")
-			}
-
-			results = append(results, v.Name)
-			nameExported := ExportiseName(v.Name)
-			responseParams = append(responseParams, nameExported)
-			responseFields[nameExported] = v.ImportType
+			responseFields = append(responseFields, templates.Field{Name: v.Field, Type: v.FieldType})
+			response = append(response, templates.FieldValue{Field: v.Field, Value: v.Local})
 		}
 
-		// Error is always returned last so ignore this one. Definitely hacky
-		responseParams = append(responseParams, "_")
 		resp := templates.Struct{
-			Name:   method.Name + "Response",
+			Name:   prefix + method.Name + "Response",
+			Doc:    docComment(prefix+method.Name+"Response is the response body of "+apiName+"."+method.Name+".", method.Doc),
 			Fields: responseFields,
 		}
 
-		err = resp.AddTo(serverFile)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-
 		// Add handlers to file
 		h := templates.HttpHandler{
-			Method:         method.Name,
-			API:            strings.Join([]string{logical.Name, logical.API.InterfaceName}, "."),
-			RequestType:    req.Name,
-			Params:         params,
-			Results:        results,
-			ResponseType:   resp.Name,
-			ResponseParams: responseParams,
+			Doc:          docComment("Handle"+prefix+method.Name+" returns the http handler serving "+apiName+"."+method.Name+".", method.Doc),
+			Prefix:       prefix,
+			Method:       method.Name,
+			API:          apiName,
+			RequestType:  req.Name,
+			Params:       args,
+			Results:      locals,
+			ResponseType: resp.Name,
+			Response:     response,
+			Body:         route.HasBody(),
+			Bindings:     bindings(route, paramsByName),
+			Status:       statusCode(route.Status),
+			NoContent:    route.Status == http.StatusNoContent,
 		}
 
-		err = h.AddTo(serverFile)
-		if err != nil {
-			return errors.Wrap(err, "")
+		if h.Body {
+			imps.addPaths("encoding/json", "io/ioutil")
 		}
-	}
 
-	err = htr.AddTo(serverFile)
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
+		if !h.NoContent {
+			imps.addPaths("encoding/json")
+		}
 
-	return nil
-}
+		for _, b := range h.Bindings {
+			if b.Parse != "" {
+				imps.addPaths("strconv")
+			}
+		}
 
-func CreateHttpClientImpl(c *config.Config, logical config.Logical, fs []reader.FunctionSignature) error {
-	err := ioeasy.CreateDirIfNotExists(logical.Name + "/client")
-	if err != nil {
-		return errors.Wrap(err, "")
+		body = append(body, &req, &resp, &h)
 	}
 
-	err = ioeasy.CreateDirIfNotExists(logical.Name + "/client/http")
-	if err != nil {
-		return errors.Wrap(err, "")
+	fc := templates.FileConfig{
+		&templates.PackageHeader{Name: "server"},
+		&templates.Imports{Values: imps.values(c.Module)},
 	}
+	fc = append(append(fc, body...), &htr)
 
-	filePath := logical.Name + "/client/http/client_gen.go"
-	err = ioeasy.CreateFileIfNotExists(filePath, templates.FileConfig{
-		&templates.PackageHeader{Name: "http"},
-	})
+	err = e.Output.WriteFile(filepath.Join(dir, generatedFileName(prefix, "server_gen.go")), fc)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	// Reset server file
-	err = os.Truncate(filePath, 0)
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
+	return nil
+}
 
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+func CreateHttpClientImpl(e *Env, logical config.Logical, api reader.Interface, prefix string, types []reader.TypeDecl, routes map[string]Route) error {
+	c := e.Config
+	dir := filepath.Join(e.logicalDir(logical), "client")
+	err := e.Output.CreateDirIfNotExists(dir)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	packageHeader := templates.PackageHeader{
-		Name: "http",
-	}
-
-	err = packageHeader.AddTo(file)
+	err = e.Output.CreateDirIfNotExists(filepath.Join(dir, "http"))
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	// Add required imports to file
-	imps := templates.Imports{
-		Values: []string{
-			"bytes",
+	// Add required imports to file. The packages used to make requests are only needed by the methods and
+	// depend on their routes.
+	imps := make(imports)
+	imps.addPaths(
+		"net/http",
+		c.Module+"/"+c.Service.Name+"/"+logical.Name,
+	)
+	if len(api.Methods) > 0 {
+		imps.addPaths(
 			"context",
-			"encoding/json",
+			"fmt",
 			"io/ioutil",
-			"net/http",
-			templates.SingleLineSpace.String(),
 			"golang.org/x/net/context/ctxhttp",
-			templates.SingleLineSpace.String(),
-			c.Module + "/" + c.Service.Name + "/" + logical.Name,
-			c.Module + "/" + c.Service.Name + "/" + logical.Name + "/" + "server",
-		},
-	}
-	err = imps.AddTo(file)
-	if err != nil {
-		return errors.Wrap(err, "")
+		)
 	}
 
-	// Add client type
-	client := templates.HttpClientType{
-		API: strings.Join([]string{logical.Name, logical.API.InterfaceName}, "."),
-	}
+	apiName := strings.Join([]string{logical.Name, api.Name}, ".")
+	var methods templates.FileConfig
+	for _, method := range api.Methods {
+		route := routes[method.Name]
 
-	err = client.AddTo(file)
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
+		params, results := nameVariables(logical.Name, method)
 
-	for _, method := range fs {
 		// Create request type
-		var params []string
-		requestObject := make(map[string]string)
-		for _, v := range method.Params {
-			if v.ImportType == "context.Context" {
-				continue
-			}
-
-			params = append(params, v.Name+" "+v.ImportType)
-
-			exportedName := ExportiseName(v.Name)
-			requestObject[exportedName] = v.Name
+		var signature []string
+		paramsByName := make(map[string]variable)
+		var requestObject []templates.FieldValue
+		for _, v := range params {
+			imps.add(v.Imports...)
+			signature = append(signature, v.Local+" "+v.ImportType)
+			paramsByName[v.Name] = v
+			requestObject = append(requestObject, templates.FieldValue{Field: v.Field, Value: v.Local})
 		}
 
 		// Create response type
 		var responseList []string
-		var results []string
+		var resultList []string
 		var returnList []string
-		for _, v := range method.Results {
-			returnList = append(returnList, v.Name)
+		for _, v := range results {
+			imps.add(v.Imports...)
+			resultList = append(resultList, v.Local+" "+v.ImportType)
+			returnList = append(returnList, v.Local)
 
 			// Do not include errors in the response type but do in the results
-			if v.ImportType == "error" {
-				results = append(results, "err error")
-				continue
+			if !v.Error {
+				responseList = append(responseList, v.Field)
 			}
+		}
 
-			results = append(results, v.Name+" "+v.ImportType)
-			responseList = append(responseList, ExportiseName(v.Name))
+		var query []templates.QueryParam
+		for _, name := range route.QueryParams {
+			query = append(query, templates.QueryParam{
+				Key:   name,
+				Value: format(paramsByName[name]),
+			})
 		}
 
 		// Add client methods to fulfill API spec
 		h := templates.HttpClient{
+			Doc:            method.Doc,
+			Prefix:         prefix,
+			Verb:           route.Verb,
+			Path:           pathExpression(route, paramsByName),
+			Query:          query,
+			Body:           route.HasBody(),
+			Status:         statusCode(route.Status),
 			Method:         method.Name,
-			Service:        logical.Name,
-			RequestType:    "server." + method.Name + "Request",
-			ResponseType:   "server." + method.Name + "Response",
-			Params:         params,
+			RequestType:    "server." + prefix + method.Name + "Request",
+			ResponseType:   "server." + prefix + method.Name + "Response",
+			Params:         signature,
 			ResponseParams: responseList,
 			Request:        requestObject,
-			Results:        results,
+			Results:        resultList,
 			Return:         returnList,
 		}
 
-		err = h.AddTo(file)
-		if err != nil {
-			return errors.Wrap(err, "")
+		if h.Body {
+			imps.addPaths("bytes", "encoding/json", c.Module+"/"+c.Service.Name+"/"+logical.Name+"/"+"server")
 		}
-	}
 
-	APIEnforcer := templates.Statement{
-		Value: "var _ " + logical.Name + "." + logical.API.InterfaceName + " = (*Client)(nil)",
-	}
+		if len(h.ResponseParams) > 0 {
+			imps.addPaths("encoding/json", c.Module+"/"+c.Service.Name+"/"+logical.Name+"/"+"server")
+		}
 
-	err = APIEnforcer.AddTo(file)
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
+		if len(route.PathParams) > 0 || len(query) > 0 {
+			imps.addPaths("net/url")
+		}
 
-	return nil
-}
+		if strings.Contains(h.Path, "strconv.") {
+			imps.addPaths("strconv")
+		}
 
-func CreateLogicalClientImpl(c *config.Config, logical config.Logical, fs []reader.FunctionSignature) error {
-	err := ioeasy.CreateDirIfNotExists(logical.Name + "/client")
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
+		for _, q := range query {
+			if strings.HasPrefix(q.Value, "strconv.") {
+				imps.addPaths("strconv")
+			}
+		}
 
-	err = ioeasy.CreateDirIfNotExists(logical.Name + "/client/logical")
-	if err != nil {
-		return errors.Wrap(err, "")
+		methods = append(methods, &h)
 	}
 
-	filePath := logical.Name + "/client/logical/client_gen.go"
-	err = ioeasy.CreateFileIfNotExists(filePath, templates.FileConfig{
-		&templates.PackageHeader{Name: "logical"},
-	})
-	if err != nil {
-		return errors.Wrap(err, "")
+	fc := templates.FileConfig{
+		&templates.PackageHeader{Name: "http"},
+		&templates.Imports{Values: imps.values(c.Module)},
+		// Add client type
+		&templates.HttpClientType{
+			Prefix: prefix,
+			API:    apiName,
+			Types:  types,
+			Doc:    docComment(prefix+"Client implements "+apiName+" by calling its server over http.", api.Doc),
+		},
 	}
+	fc = append(fc, methods...)
+	fc = append(fc, &templates.Statement{
+		Value: "var _ " + logical.Name + "." + api.Name + " = (*" + prefix + "Client)(nil)",
+	})
 
-	// Reset server file
-	err = os.Truncate(filePath, 0)
+	err = e.Output.WriteFile(filepath.Join(dir, "http", generatedFileName(prefix, "client_gen.go")), fc)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+	return nil
+}
+
+func CreateLogicalClientImpl(e *Env, logical config.Logical, api reader.Interface, prefix string, types []reader.TypeDecl) error {
+	c := e.Config
+	dir := filepath.Join(e.logicalDir(logical), "client")
+	err := e.Output.CreateDirIfNotExists(dir)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	packageHeader := templates.PackageHeader{
-		Name: "logical",
-	}
-
-	err = packageHeader.AddTo(file)
+	err = e.Output.CreateDirIfNotExists(filepath.Join(dir, "logical"))
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	// Add required imports to file
-	imps := templates.Imports{
-		Values: []string{
-			"context",
-			templates.SingleLineSpace.String(),
-			c.Module + "/" + c.Service.Name + "/" + logical.Name,
-			c.Module + "/" + c.Service.Name + "/" + logical.Name + "/" + "server",
-		},
-	}
-	err = imps.AddTo(file)
-	if err != nil {
-		return errors.Wrap(err, "")
+	// Add required imports to file. The methods always take the context as context.Context whatever the API
+	// imports it as.
+	imps := make(imports)
+	imps.addPaths(
+		c.Module+"/"+c.Service.Name+"/"+logical.Name,
+		c.Module+"/"+c.Service.Name+"/"+logical.Name+"/"+"server",
+	)
+	if len(api.Methods) > 0 {
+		imps.addPaths("context")
+	}
+	for _, method := range api.Methods {
+		params, results := nameVariables(logical.Name, method)
+		for _, v := range append(params, results...) {
+			imps.add(v.Imports...)
+		}
 	}
 
 	// Add client type
-	client := templates.LogicalClientType{
-		API: strings.Join([]string{logical.Name, logical.API.InterfaceName}, "."),
+	apiName := strings.Join([]string{logical.Name, api.Name}, ".")
+	fc := templates.FileConfig{
+		&templates.PackageHeader{Name: "logical"},
+		&templates.Imports{Values: imps.values(c.Module)},
+		&templates.LogicalClientType{
+			Prefix: prefix,
+			API:    apiName,
+			Types:  types,
+			Doc:    docComment(prefix+"Client implements "+apiName+" by calling the server implementation in process.", api.Doc),
+		},
 	}
 
-	err = client.AddTo(file)
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
+	for _, method := range api.Methods {
+		vars, _ := nameVariables(logical.Name, method)
 
-	for _, method := range fs {
 		var params []string
 		var inlineParams []string
-		for _, v := range method.Params {
-			if v.ImportType == "context.Context" {
-				continue
-			}
-
-			params = append(params, v.Name+" "+v.ImportType)
-			inlineParams = append(inlineParams, v.Name)
+		for _, v := range vars {
+			params = append(params, v.Local+" "+v.ImportType)
+			inlineParams = append(inlineParams, v.Arg(v.Local))
 		}
 
 		var results []string
@@ -510,24 +560,21 @@ func CreateLogicalClientImpl(c *config.Config, logical config.Logical, fs []read
 			results = append(results, v.ImportType)
 		}
 
-		logicalMethod := &templates.LogicalClientTemplate{
+		fc = append(fc, &templates.LogicalClientTemplate{
+			Doc:          method.Doc,
+			Prefix:       prefix,
 			Method:       method.Name,
 			Params:       params,
 			InlineParams: inlineParams,
 			Results:      results,
-		}
-
-		err = logicalMethod.AddTo(file)
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
+		})
 	}
 
-	APIEnforcer := templates.Statement{
-		Value: "var _ " + logical.Name + "." + logical.API.InterfaceName + " = (*Client)(nil)",
-	}
+	fc = append(fc, &templates.Statement{
+		Value: "var _ " + logical.Name + "." + api.Name + " = (*" + prefix + "Client)(nil)",
+	})
 
-	err = APIEnforcer.AddTo(file)
+	err = e.Output.WriteFile(filepath.Join(dir, "logical", generatedFileName(prefix, "client_gen.go")), fc)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
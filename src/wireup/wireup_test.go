@@ -0,0 +1,184 @@
+package wireup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gomicro/config"
+	"gomicro/ioeasy"
+)
+
+func TestClientImports(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "apollo", "users")
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		filepath.Join(root, "go.mod"): "module example\n\ngo 1.23\n",
+		filepath.Join(dir, "api.go"): `package users
+
+import (
+	gocontext "context"
+	neturl "net/url"
+)
+
+type API interface {
+	Get(ctx gocontext.Context, u *neturl.URL) error
+}
+`,
+	}
+	for path, src := range files {
+		err := ioutil.WriteFile(path, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logical := config.Logical{
+		Name: "users",
+		API: config.API{
+			FileName:        "api.go",
+			InterfaceName:   "API",
+			Implementations: config.APIImplementation{Local: true, HTTP: true},
+		},
+	}
+	c := &config.Config{Module: "example", Service: config.Service{Name: "apollo", Logicals: []config.Logical{logical}}}
+
+	tests := []struct {
+		generator string
+		path      string
+	}{
+		{generator: GeneratorLogicalClient, path: "client/logical/client_gen.go"},
+		{generator: GeneratorHTTPClient, path: "client/http/client_gen.go"},
+		{generator: GeneratorHTTPServer, path: "server/server_gen.go"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.generator, func(t *testing.T) {
+			dr := ioeasy.NewDryRun()
+			e := NewEnv(c, root, ioeasy.NewOutput(dr, nil, false))
+
+			err := runGenerator(e, logical, test.generator)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			src := string(dr.Files[filepath.Join(dir, filepath.FromSlash(test.path))])
+			for _, want := range []string{`neturl "net/url"`, "*neturl.URL"} {
+				if !strings.Contains(src, want) {
+					t.Errorf("%s does not hold %s", test.path, want)
+				}
+			}
+
+			if strings.Contains(src, "gocontext") {
+				t.Errorf("%s refers to the context by the API's import name", test.path)
+			}
+
+			if strings.Contains(src, "ctx context.Context") && !strings.Contains(src, `"context"`) {
+				t.Errorf("%s does not import context", test.path)
+			}
+		})
+	}
+}
+
+func TestAPIFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example\n\ngo 1.23\n",
+		"apollo/users/api.go": `package users
+
+import (
+	"context"
+
+	"example/shared"
+)
+
+type API interface {
+	Base
+	shared.Reader
+	Get(ctx context.Context, u *User) error
+}
+`,
+		"apollo/users/base.go": `package users
+
+import "context"
+
+type Base interface {
+	Ping(ctx context.Context) error
+}
+`,
+		"apollo/users/user.go": "package users\n\ntype User struct {\n\tName string\n}\n",
+		"shared/shared.go": `package shared
+
+import "context"
+
+type Reader interface {
+	Closer
+	Read(ctx context.Context) error
+}
+`,
+		"shared/closer.go": `package shared
+
+import "context"
+
+type Closer interface {
+	Close(ctx context.Context) error
+}
+`,
+		"shared/version.go": "package shared\n\nconst Version = 1\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logical := config.Logical{
+		Name: "users",
+		API:  config.API{FileName: "api.go", InterfaceName: "API"},
+	}
+	c := &config.Config{Module: "example", Service: config.Service{Name: "apollo", Logicals: []config.Logical{logical}}}
+	e := NewEnv(c, root, ioeasy.NewOutput(ioeasy.NewDryRun(), nil, false))
+
+	got, err := APIFiles(e, logical)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every file of the imported package of the module is an input, not only those that declare the embeds
+	want := []string{
+		"apollo/users/api.go",
+		"apollo/users/base.go",
+		"apollo/users/user.go",
+		"shared/closer.go",
+		"shared/shared.go",
+		"shared/version.go",
+	}
+	var rel []string
+	for _, path := range got {
+		r, err := filepath.Rel(root, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rel = append(rel, filepath.ToSlash(r))
+	}
+
+	if !reflect.DeepEqual(rel, want) {
+		t.Errorf("got %v, want %v", rel, want)
+	}
+}